@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chrishrb/go-grip/pkg"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [dir]",
+	Short: "Check markdown files for broken links, anchors and images",
+	Long: `Check all markdown files below a directory for broken relative links, anchors,
+wiki links and images. Exits with a non-zero code if problems were found.
+Links to other sites are only checked with --external.`,
+	Example: `  go-grip check docs/
+  go-grip check --format github`,
+	Args: cobra.MaximumNArgs(1),
+	// Broken links are not a usage error
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		gfm, _ := cmd.Flags().GetBool("gfm")
+		external, _ := cmd.Flags().GetBool("external")
+		format, _ := cmd.Flags().GetString("format")
+
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		parser := pkg.NewParser("auto")
+		parser.SetGFM(gfm)
+		checker := pkg.NewChecker(parser)
+		checker.SetExternal(external)
+		diagnostics, err := checker.Check(dir)
+		if err != nil {
+			return err
+		}
+
+		switch format {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(diagnostics); err != nil {
+				return err
+			}
+		case "github":
+			for _, d := range diagnostics {
+				fmt.Printf("::error file=%s,line=%d,col=%d::%s\n", d.File, d.Line, d.Column, escapeAnnotation(d.Message))
+			}
+		case "human":
+			for _, d := range diagnostics {
+				fmt.Printf("%s:%d:%d: %s (%s)\n", d.File, d.Line, d.Column, d.Message, d.Target)
+			}
+			if len(diagnostics) == 0 {
+				fmt.Println("✅ No problems found")
+			}
+		default:
+			return fmt.Errorf("unknown format %q, use human, json or github", format)
+		}
+
+		if len(diagnostics) > 0 {
+			return fmt.Errorf("found %d problem(s)", len(diagnostics))
+		}
+		return nil
+	},
+}
+
+// escapeAnnotation escapes the message of a GitHub Actions workflow command
+func escapeAnnotation(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func init() {
+	checkCmd.Flags().Bool("gfm", false, "Render footnotes, definition lists and www. autolinks like GitHub")
+	checkCmd.Flags().Bool("external", false, "Also check links to other sites")
+	checkCmd.Flags().String("format", "human", "Output format [human/json/github]")
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/chrishrb/go-grip/pkg"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [dir]",
+	Short: "Export a directory of markdown files as a static html site",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		theme, _ := cmd.Flags().GetString("theme")
+		boundingBox, _ := cmd.Flags().GetBool("bounding-box")
+		gfm, _ := cmd.Flags().GetBool("gfm")
+		codeStyle, _ := cmd.Flags().GetString("code-style")
+		frontmatter, _ := cmd.Flags().GetString("frontmatter")
+		output, _ := cmd.Flags().GetString("output")
+
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+
+		parser := pkg.NewParser(theme)
+		parser.SetGFM(gfm)
+		parser.SetCodeStyle(codeStyle)
+		parser.SetFrontmatter(frontmatter)
+		exporter := pkg.NewExporter(theme, boundingBox, parser)
+		return exporter.Export(dir, output)
+	},
+}
+
+func init() {
+	exportCmd.Flags().String("theme", "auto", "Select css theme [light/dark/auto]")
+	exportCmd.Flags().Bool("bounding-box", true, "Add bounding box to HTML")
+	exportCmd.Flags().Bool("gfm", false, "Render footnotes, definition lists and www. autolinks like GitHub")
+	exportCmd.Flags().String("code-style", "github,github-dark", "Chroma style for code, \"light,dark\" selects one per mode")
+	exportCmd.Flags().String("frontmatter", "table", "Show the frontmatter as [hidden/table/collapsible]")
+	exportCmd.Flags().StringP("output", "o", "out", "Output directory")
+	rootCmd.AddCommand(exportCmd)
+}
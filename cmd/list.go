@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chrishrb/go-grip/pkg"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List running go-grip instances",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		instances, err := pkg.ListInstances()
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			// Never print the control token
+			for i := range instances {
+				instances[i].Token = ""
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(instances)
+		}
+
+		if len(instances) == 0 {
+			fmt.Println("No running instances")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PID\tPORT\tURL\tDIRECTORY\tFILE\tUPTIME")
+		for _, inst := range instances {
+			uptime := time.Since(inst.StartTime).Round(time.Second)
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\n", inst.PID, inst.Port, inst.URL(), describeDirectories(inst), inst.InitialFile, uptime)
+		}
+		return w.Flush()
+	},
+}
+
+// describeDirectories returns the served directory or the list of mounts
+func describeDirectories(inst pkg.Instance) string {
+	if len(inst.Mounts) == 0 {
+		return inst.Directory
+	}
+	var mounts []string
+	for _, m := range inst.Mounts {
+		mounts = append(mounts, m.Name+"="+m.Directory)
+	}
+	return strings.Join(mounts, ", ")
+}
+
+func init() {
+	listCmd.Flags().Bool("json", false, "Print instances as JSON")
+	rootCmd.AddCommand(listCmd)
+}
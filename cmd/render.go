@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/chrishrb/go-grip/pkg"
+	"github.com/spf13/cobra"
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render <file>",
+	Short: "Render a markdown file to html on stdout",
+	Long: `Render a markdown file to html on stdout. With --standalone a single html
+document is written that embeds stylesheets, emojis, images and mermaid.`,
+	Example: `  go-grip render README.md --standalone > doc.html`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		theme, _ := cmd.Flags().GetString("theme")
+		boundingBox, _ := cmd.Flags().GetBool("bounding-box")
+		gfm, _ := cmd.Flags().GetBool("gfm")
+		codeStyle, _ := cmd.Flags().GetString("code-style")
+		frontmatter, _ := cmd.Flags().GetString("frontmatter")
+		standalone, _ := cmd.Flags().GetBool("standalone")
+
+		parser := pkg.NewParser(theme)
+		parser.SetGFM(gfm)
+		parser.SetCodeStyle(codeStyle)
+		parser.SetFrontmatter(frontmatter)
+		exporter := pkg.NewExporter(theme, boundingBox, parser)
+		return exporter.Render(os.Stdout, args[0], standalone)
+	},
+}
+
+func init() {
+	renderCmd.Flags().String("theme", "auto", "Select css theme [light/dark/auto]")
+	renderCmd.Flags().Bool("bounding-box", true, "Add bounding box to HTML")
+	renderCmd.Flags().Bool("gfm", false, "Render footnotes, definition lists and www. autolinks like GitHub")
+	renderCmd.Flags().String("code-style", "github,github-dark", "Chroma style for code, \"light,dark\" selects one per mode")
+	renderCmd.Flags().String("frontmatter", "table", "Show the frontmatter as [hidden/table/collapsible]")
+	renderCmd.Flags().Bool("standalone", false, "Write a self-contained html document")
+	rootCmd.AddCommand(renderCmd)
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/chrishrb/go-grip/pkg"
@@ -12,24 +13,75 @@ var rootCmd = &cobra.Command{
 	Short: "Render markdown documents as html",
 	Long:  `Render markdown documents as html. Can handle a single file or a directory of markdown files.`,
 	Args:  cobra.MatchAll(cobra.OnlyValidArgs),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		theme, _ := cmd.Flags().GetString("theme")
-		browser, _ := cmd.Flags().GetBool("browser")
-		host, _ := cmd.Flags().GetString("host")
-		port, _ := cmd.Flags().GetInt("port")
-		boundingBox, _ := cmd.Flags().GetBool("bounding-box")
-
-		var path string
-		if len(args) == 1 {
-			path = args[0]
-		} else {
-			path = "."
+	RunE:  runServe,
+}
+
+// runServe serves the path given as argument, or reuses a running server
+func runServe(cmd *cobra.Command, args []string) error {
+	browser, _ := cmd.Flags().GetBool("browser")
+	newInstance, _ := cmd.Flags().GetBool("new-instance")
+
+	var path string
+	if len(args) == 1 {
+		path = args[0]
+	} else {
+		path = "."
+	}
+
+	if !newInstance {
+		reused, err := reuseInstance(path, browser)
+		if err != nil || reused {
+			return err
 		}
+	}
+
+	return newServer(cmd).Serve(path)
+}
+
+// newServer creates a server from the flags added by addServerFlags
+func newServer(cmd *cobra.Command) *pkg.Server {
+	theme, _ := cmd.Flags().GetString("theme")
+	browser, _ := cmd.Flags().GetBool("browser")
+	host, _ := cmd.Flags().GetString("host")
+	port, _ := cmd.Flags().GetInt("port")
+	boundingBox, _ := cmd.Flags().GetBool("bounding-box")
+	idleTimeout, _ := cmd.Flags().GetDuration("exit-after-idle")
+	gfm, _ := cmd.Flags().GetBool("gfm")
+	codeStyle, _ := cmd.Flags().GetString("code-style")
+	frontmatter, _ := cmd.Flags().GetString("frontmatter")
+
+	parser := pkg.NewParser(theme)
+	parser.SetGFM(gfm)
+	parser.SetCodeStyle(codeStyle)
+	parser.SetFrontmatter(frontmatter)
+	server := pkg.NewServer(host, port, theme, boundingBox, browser, parser)
+	server.SetIdleTimeout(idleTimeout)
+	return server
+}
+
+// reuseInstance opens the path in an already running server for the same
+// directory. It reports whether such a server was found.
+func reuseInstance(path string, browser bool) (bool, error) {
+	directory, initialFile, err := pkg.ResolveInput(path)
+	if err != nil {
+		return false, err
+	}
+
+	inst, err := pkg.FindInstance(directory)
+	if err != nil || inst == nil {
+		// A broken registry must not keep us from serving
+		return false, nil
+	}
 
-		parser := pkg.NewParser(theme)
-		server := pkg.NewServer(host, port, theme, boundingBox, browser, parser)
-		return server.Serve(path)
-	},
+	baseURL, _ := inst.BaseURL(directory)
+	addr := baseURL + initialFile
+	fmt.Printf("♻️  Reusing running server: %s\n", addr)
+	if browser {
+		if err := pkg.Open(addr); err != nil {
+			fmt.Println("❌ Error opening browser:", err)
+		}
+	}
+	return true, nil
 }
 
 func Execute() {
@@ -39,10 +91,20 @@ func Execute() {
 	}
 }
 
+// addServerFlags adds the flags shared by all commands that start a server
+func addServerFlags(cmd *cobra.Command) {
+	cmd.Flags().String("theme", "auto", "Select css theme [light/dark/auto]")
+	cmd.Flags().BoolP("browser", "b", true, "Open new browser tab")
+	cmd.Flags().StringP("host", "H", "localhost", "Host to use")
+	cmd.Flags().IntP("port", "p", 6419, "Port to use")
+	cmd.Flags().Bool("bounding-box", true, "Add bounding box to HTML")
+	cmd.Flags().Bool("gfm", false, "Render footnotes, definition lists and www. autolinks like GitHub")
+	cmd.Flags().String("code-style", "github,github-dark", "Chroma style for code, \"light,dark\" selects one per mode")
+	cmd.Flags().String("frontmatter", "table", "Show the frontmatter as [hidden/table/collapsible]")
+	cmd.Flags().Bool("new-instance", false, "Start a new server even if one already serves the directory")
+	cmd.Flags().Duration("exit-after-idle", 0, "Exit when no page was requested for this long, e.g. 30m (0 disables)")
+}
+
 func init() {
-	rootCmd.Flags().String("theme", "auto", "Select css theme [light/dark/auto]")
-	rootCmd.Flags().BoolP("browser", "b", true, "Open new browser tab")
-	rootCmd.Flags().StringP("host", "H", "localhost", "Host to use")
-	rootCmd.Flags().IntP("port", "p", 6419, "Port to use")
-	rootCmd.Flags().Bool("bounding-box", true, "Add bounding box to HTML")
+	addServerFlags(rootCmd)
 }
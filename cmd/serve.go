@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chrishrb/go-grip/pkg"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [path]",
+	Short: "Serve a file, a directory or several mounted directories",
+	Long: `Serve a file or directory like the root command does. With --mount several
+documentation roots are served by one server, each below its own URL prefix.`,
+	Example: `  go-grip serve --mount api=../api/docs --mount web=../web/docs`,
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mountFlags, _ := cmd.Flags().GetStringArray("mount")
+		if len(mountFlags) == 0 {
+			return runServe(cmd, args)
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("a path cannot be combined with --mount")
+		}
+
+		mounts, err := parseMounts(mountFlags)
+		if err != nil {
+			return err
+		}
+		return newServer(cmd).ServeMounts(mounts)
+	},
+}
+
+// parseMounts parses name=dir pairs given with --mount
+func parseMounts(values []string) ([]pkg.Mount, error) {
+	var mounts []pkg.Mount
+	for _, v := range values {
+		name, dir, ok := strings.Cut(v, "=")
+		if !ok || name == "" || dir == "" {
+			return nil, fmt.Errorf("invalid mount %q, expected name=dir", v)
+		}
+		mounts = append(mounts, pkg.Mount{Name: name, Directory: dir})
+	}
+	return mounts, nil
+}
+
+func init() {
+	addServerFlags(serveCmd)
+	serveCmd.Flags().StringArray("mount", nil, "Serve a directory below a URL prefix, as name=dir (repeatable)")
+	rootCmd.AddCommand(serveCmd)
+}
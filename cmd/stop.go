@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/chrishrb/go-grip/pkg"
+	"github.com/spf13/cobra"
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop <port|dir|all>",
+	Short: "Stop running go-grip instances",
+	Long:  `Stop running go-grip instances by port, by served directory or all of them.`,
+	Args:  cobra.ExactArgs(1),
+	// Failing to find an instance is not a usage error
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		instances, err := pkg.ListInstances()
+		if err != nil {
+			return err
+		}
+
+		matches, err := selectInstances(instances, args[0])
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no running instance matches %q", args[0])
+		}
+
+		var errs []error
+		for _, inst := range matches {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			err := inst.Stop(ctx)
+			cancel()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			fmt.Printf("🛑 Stopped %s\n", inst.URL())
+		}
+		return errors.Join(errs...)
+	},
+}
+
+// selectInstances returns the instances matching a port, a directory or "all"
+func selectInstances(instances []pkg.Instance, target string) ([]pkg.Instance, error) {
+	if target == "all" {
+		return instances, nil
+	}
+
+	var matches []pkg.Instance
+	if port, err := strconv.Atoi(target); err == nil {
+		for _, inst := range instances {
+			if inst.Port == port {
+				matches = append(matches, inst)
+			}
+		}
+		return matches, nil
+	}
+
+	dir, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range instances {
+		if _, ok := inst.BaseURL(dir); ok {
+			matches = append(matches, inst)
+		}
+	}
+	return matches, nil
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+}
@@ -0,0 +1,35 @@
+// Copy buttons for code blocks rendered by go-grip
+(function () {
+  if (!navigator.clipboard) return;
+
+  document.querySelectorAll("pre.chroma").forEach(function (pre) {
+    // Blocks with a title already have a wrapper
+    var wrapper = pre.parentElement;
+    if (!wrapper.classList.contains("code-block")) {
+      wrapper = document.createElement("div");
+      wrapper.className = "code-block";
+      pre.parentNode.insertBefore(wrapper, pre);
+      wrapper.appendChild(pre);
+    }
+
+    var button = document.createElement("button");
+    button.type = "button";
+    button.className = "code-copy";
+    button.setAttribute("aria-label", "Copy code");
+    button.textContent = "Copy";
+    button.addEventListener("click", function () {
+      // Line numbers are not part of the code
+      var code = pre.cloneNode(true);
+      code.querySelectorAll(".ln").forEach(function (ln) {
+        ln.remove();
+      });
+      navigator.clipboard.writeText(code.textContent).then(function () {
+        button.textContent = "Copied";
+        setTimeout(function () {
+          button.textContent = "Copy";
+        }, 2000);
+      });
+    });
+    wrapper.appendChild(button);
+  });
+})();
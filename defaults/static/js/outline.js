@@ -0,0 +1,46 @@
+// "On this page" outline with scroll-spy for documents rendered by go-grip
+(function () {
+  var outline = document.querySelector(".outline-toggle");
+  if (!outline) return;
+
+  // The outline floats next to the document on wide screens
+  var wide = window.matchMedia("(min-width: 1480px)");
+  function expand() {
+    if (wide.matches) outline.open = true;
+  }
+  expand();
+  wide.addEventListener("change", expand);
+
+  var links = Array.prototype.slice.call(outline.querySelectorAll("a"));
+  var targets = links.map(function (link) {
+    return document.getElementById(decodeURIComponent(link.hash.slice(1)));
+  });
+
+  // Highlight the last heading scrolled past the top of the window
+  var active;
+  function update() {
+    var current = 0;
+    targets.forEach(function (target, i) {
+      if (target && target.getBoundingClientRect().top <= 80) current = i;
+    });
+    if (active === links[current]) return;
+    if (active) active.classList.remove("active");
+    active = links[current];
+    active.classList.add("active");
+  }
+
+  var scheduled = false;
+  window.addEventListener(
+    "scroll",
+    function () {
+      if (scheduled) return;
+      scheduled = true;
+      window.requestAnimationFrame(function () {
+        scheduled = false;
+        update();
+      });
+    },
+    { passive: true },
+  );
+  update();
+})();
@@ -0,0 +1,109 @@
+// Search box for the documentation served by go-grip
+(function () {
+  var input = document.querySelector(".search-input");
+  var list = document.querySelector(".search-results");
+  if (!input || !list) return;
+
+  var timer;
+  var lastQuery = "";
+
+  function clear() {
+    list.innerHTML = "";
+    list.hidden = true;
+  }
+
+  function render(results) {
+    list.innerHTML = "";
+    if (results.length === 0) {
+      var empty = document.createElement("li");
+      empty.className = "search-empty";
+      empty.textContent = "No results";
+      list.appendChild(empty);
+    }
+    results.forEach(function (r) {
+      var item = document.createElement("li");
+      var link = document.createElement("a");
+      link.href = r.url;
+
+      var title = document.createElement("span");
+      title.className = "search-title";
+      title.textContent = r.title;
+      link.appendChild(title);
+
+      if (r.heading) {
+        var heading = document.createElement("span");
+        heading.className = "search-heading";
+        heading.textContent = " › " + r.heading;
+        link.appendChild(heading);
+      }
+
+      var path = document.createElement("span");
+      path.className = "search-path";
+      path.textContent = r.path;
+      link.appendChild(path);
+
+      if (r.snippet) {
+        var snippet = document.createElement("span");
+        snippet.className = "search-snippet";
+        snippet.textContent = r.snippet;
+        link.appendChild(snippet);
+      }
+
+      item.appendChild(link);
+      list.appendChild(item);
+    });
+    list.hidden = false;
+  }
+
+  function search() {
+    var query = input.value.trim();
+    if (query === lastQuery) return;
+    lastQuery = query;
+    if (query === "") {
+      clear();
+      return;
+    }
+    fetch(input.dataset.searchUrl + "?q=" + encodeURIComponent(query))
+      .then(function (resp) {
+        return resp.json();
+      })
+      .then(function (results) {
+        // Ignore answers to outdated queries
+        if (query === lastQuery) render(results);
+      })
+      .catch(clear);
+  }
+
+  input.addEventListener("input", function () {
+    clearTimeout(timer);
+    timer = setTimeout(search, 150);
+  });
+
+  input.addEventListener("keydown", function (e) {
+    if (e.key === "Enter") {
+      var first = list.querySelector("a");
+      if (first) location.href = first.href;
+    } else if (e.key === "Escape") {
+      input.value = "";
+      lastQuery = "";
+      clear();
+      input.blur();
+    }
+  });
+
+  document.addEventListener("keydown", function (e) {
+    var tag = document.activeElement && document.activeElement.tagName;
+    if (e.key === "/" && tag !== "INPUT" && tag !== "TEXTAREA") {
+      e.preventDefault();
+      input.focus();
+    }
+  });
+
+  document.addEventListener("click", function (e) {
+    if (!input.parentNode.contains(e.target)) list.hidden = true;
+  });
+
+  input.addEventListener("focus", function () {
+    if (list.children.length > 0) list.hidden = false;
+  });
+})();
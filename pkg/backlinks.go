@@ -0,0 +1,246 @@
+package pkg
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Regex for links to markdown files of the same tree, as produced by
+// resolveMarkdownLinks without a prefix
+var internalLinkRegex = regexp.MustCompile(`href="(/[^"#?]*\.md)(?:#[^"]*)?"`)
+
+// linkGraph records which markdown files link to which. It is built on the
+// first query and kept up to date afterwards.
+type linkGraph struct {
+	root   string
+	parser *Parser
+	links  *wikiIndex
+
+	mu          sync.Mutex
+	built       bool
+	titles      map[string]string   // URL path -> title of every markdown file
+	outgoing    map[string][]string // URL path -> URL paths it links to
+	includes    map[string][]string // URL path -> URL paths of the files it includes
+	wikiTargets map[string][]string // URL path -> keys of the pages its wiki links name
+}
+
+// backlink is a page linking to another one, as returned by the endpoint
+type backlink struct {
+	Path  string `json:"path"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+func newLinkGraph(root string, parser *Parser, links *wikiIndex) *linkGraph {
+	return &linkGraph{root: root, parser: parser, links: links}
+}
+
+// build scans all markdown files, the caller holds the lock
+func (g *linkGraph) build() {
+	toc, err := ScanMarkdownFiles(g.root, g.parser.gfm)
+	if err != nil {
+		log.Printf("Error scanning directory: %v", err)
+		return
+	}
+
+	g.built = true
+	g.titles = make(map[string]string)
+	g.outgoing = make(map[string][]string)
+	g.includes = make(map[string][]string)
+	g.wikiTargets = make(map[string][]string)
+	for _, file := range toc.Files {
+		g.titles["/"+filepath.ToSlash(file.Path)] = file.Title
+	}
+	for urlPath := range g.titles {
+		g.extractLinks(urlPath)
+	}
+}
+
+// update brings the graph up to date after a file or directory changed.
+// Changed files and the files including them are scanned again, a new file
+// is added along with the pages whose wiki links may now point to it.
+// Removed files and directories may change where wiki links point to, so
+// the graph is rebuilt on the next query.
+func (g *linkGraph) update(changed string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.built {
+		return
+	}
+	for page, deps := range g.includes {
+		if slices.Contains(deps, changed) {
+			g.extractLinks(page)
+		}
+	}
+
+	_, known := g.titles[changed]
+	info, err := os.Stat(filepath.Join(g.root, filepath.FromSlash(changed)))
+	switch {
+	case known && err == nil && !info.IsDir():
+		g.extractLinks(changed)
+	case !known && err == nil && !info.IsDir() && isMarkdownPath(changed):
+		g.addPage(changed, info)
+	case known || err != nil || info.IsDir() || isMarkdownPath(changed):
+		g.built = false
+	}
+}
+
+// addPage adds a new markdown file to the graph. Only wiki links naming the
+// file can point to it now, so only the pages with such links are scanned
+// again. The caller holds the lock.
+func (g *linkGraph) addPage(urlPath string, info os.FileInfo) {
+	fullPath := filepath.Join(g.root, filepath.FromSlash(urlPath))
+	meta := readFileMeta(fullPath, info, g.parser.gfm)
+	g.titles[urlPath] = meta.title
+
+	names := wikiPageNames(MarkdownFile{Path: filepath.FromSlash(strings.TrimPrefix(urlPath, "/")), Title: meta.title, FullPath: fullPath})
+	for page, keys := range g.wikiTargets {
+		if slices.ContainsFunc(keys, func(key string) bool { return slices.Contains(names, key) }) {
+			g.extractLinks(page)
+		}
+	}
+	g.extractLinks(urlPath)
+}
+
+// extractLinks renders a file like it is served and records the markdown
+// files it links to, the files it includes and the pages its wiki links
+// name. The caller holds the lock.
+func (g *linkGraph) extractLinks(urlPath string) {
+	g.outgoing[urlPath], g.includes[urlPath], g.wikiTargets[urlPath] = g.renderLinks(urlPath)
+}
+
+// renderLinks returns the markdown files a file links to, the files it
+// includes and the keys of the pages its wiki links name, also those of
+// the included files. A file that fails to render has no links, so one
+// broken document does not break the backlinks of all others.
+func (g *linkGraph) renderLinks(urlPath string) (targets []string, deps []string, wikiTargets []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Error: failed to render %s: %v", urlPath, r)
+			targets, deps, wikiTargets = nil, nil, nil
+		}
+	}()
+
+	content, err := os.ReadFile(filepath.Join(g.root, filepath.FromSlash(urlPath)))
+	if err != nil {
+		return nil, nil, nil
+	}
+
+	page, deps := renderPage(g.parser, g.root, g.links, content, urlPath, "")
+
+	wikiTargets = wikiTargetKeys(content)
+	for _, dep := range deps {
+		if data, err := os.ReadFile(filepath.Join(g.root, filepath.FromSlash(dep))); err == nil {
+			wikiTargets = append(wikiTargets, wikiTargetKeys(data)...)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, m := range internalLinkRegex.FindAllSubmatch(page.HTML, -1) {
+		target := string(m[1])
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		target = path.Clean(target)
+		if target == urlPath || seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	return targets, deps, wikiTargets
+}
+
+// wikiTargetKeys returns the keys of the pages the wiki links and embeds of
+// content name
+func wikiTargetKeys(content []byte) []string {
+	var keys []string
+	for _, link := range findWikiLinks(content) {
+		target, _, _ := strings.Cut(link.text, "|")
+		page, _, _ := strings.Cut(target, "#")
+		if page == "" {
+			continue
+		}
+		key, _ := wikiTargetKey(page)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// backlinks returns the pages linking to urlPath, sorted by title
+func (g *linkGraph) backlinks(urlPath string) []backlink {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.built {
+		g.build()
+	}
+
+	results := []backlink{}
+	for source, targets := range g.outgoing {
+		for _, target := range targets {
+			if target == urlPath {
+				results = append(results, backlink{Path: source, URL: escapePath(source), Title: g.titles[source]})
+				break
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !strings.EqualFold(results[i].Title, results[j].Title) {
+			return strings.ToLower(results[i].Title) < strings.ToLower(results[j].Title)
+		}
+		return results[i].Path < results[j].Path
+	})
+	return results
+}
+
+// orphans returns the pages no other page links to, sorted. The README or
+// index of the root is the entry point and never an orphan.
+func (g *linkGraph) orphans() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.built {
+		g.build()
+	}
+
+	linked := map[string]bool{}
+	for source, targets := range g.outgoing {
+		for _, target := range targets {
+			if target != source {
+				linked[target] = true
+			}
+		}
+	}
+	var orphans []string
+	for page := range g.titles {
+		if !linked[page] && !strings.EqualFold(page, "/README.md") && !strings.EqualFold(page, "/index.md") {
+			orphans = append(orphans, page)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// serve answers /_api/backlinks?path=/page.md with the pages linking to
+// the given page, their URLs below the escaped prefix of the mount
+func (g *linkGraph) serve(w http.ResponseWriter, r *http.Request, prefix string) {
+	results := g.backlinks(path.Clean("/" + r.URL.Query().Get("path")))
+	for i := range results {
+		results[i].URL = prefix + results[i].URL
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
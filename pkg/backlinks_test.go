@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkGraphAddsNewPages(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("README.md", "# Home\n\nSee [[Setup Guide]].\n")
+	write("other.md", "# Other\n\nSee [[Unrelated]].\n")
+
+	links := newWikiIndex(root, false)
+	graph := newLinkGraph(root, NewParser("light"), links)
+	if got := graph.orphans(); len(got) != 1 || got[0] != "/other.md" {
+		t.Fatalf("orphans = %v, want [/other.md]", got)
+	}
+
+	// A new page is added without rebuilding the graph, the page whose
+	// wiki link failed before now links to it
+	write("setup-guide.md", "# Setup Guide\n")
+	links.invalidate("/setup-guide.md")
+	graph.update("/setup-guide.md")
+	if !graph.built {
+		t.Error("graph was dropped after adding a page")
+	}
+	got := graph.backlinks("/setup-guide.md")
+	if len(got) != 1 || got[0].Path != "/README.md" {
+		t.Errorf("backlinks = %v, want /README.md", got)
+	}
+	if title := graph.titles["/setup-guide.md"]; title != "Setup Guide" {
+		t.Errorf("title = %q, want %q", title, "Setup Guide")
+	}
+}
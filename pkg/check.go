@@ -0,0 +1,488 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// maxExternalChecks is how many external links are checked at the same time
+const maxExternalChecks = 8
+
+// Regex for the ids and names a link fragment can point to
+var anchorRegex = regexp.MustCompile(`\s(?:id|name)="([^"]+)"`)
+
+// Kinds of problems found by the Checker
+const (
+	KindLink     = "link"     // Relative link to a missing file
+	KindAnchor   = "anchor"   // Link to a missing heading or element
+	KindImage    = "image"    // Missing image
+	KindWiki     = "wiki"     // Wiki link without matching page or heading
+	KindExternal = "external" // Link to another site that does not work
+	KindRender   = "render"   // Document that fails to render
+)
+
+// Diagnostic is a problem found by the Checker
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+	Message string `json:"message"`
+}
+
+// Checker finds broken links, anchors, wiki links and images in a directory
+// of markdown files
+type Checker struct {
+	parser   *Parser
+	external bool
+	client   *http.Client
+}
+
+func NewChecker(parser *Parser) *Checker {
+	return &Checker{
+		parser: parser,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// SetExternal enables checking links to other sites
+func (c *Checker) SetExternal(enabled bool) {
+	c.external = enabled
+}
+
+// checkRun holds the state of checking one directory
+type checkRun struct {
+	checker     *Checker
+	root        string
+	directory   string // Directory as given, for the file names
+	links       *wikiIndex
+	anchors     map[string]map[string]bool // URL path -> ids of the page
+	broken      map[string]bool            // URL paths that failed to render
+	externals   map[string][]Diagnostic    // External URL -> where it is used
+	diagnostics []Diagnostic
+}
+
+// Check checks every markdown file below directory. The file names of the
+// diagnostics start with directory as given.
+func (c *Checker) Check(directory string) ([]Diagnostic, error) {
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	toc, err := ScanMarkdownFiles(root, c.parser.gfm)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &checkRun{
+		checker:   c,
+		root:      root,
+		directory: directory,
+		links:     newWikiIndex(root, c.parser.gfm),
+		anchors:   make(map[string]map[string]bool),
+		broken:    make(map[string]bool),
+		externals: make(map[string][]Diagnostic),
+	}
+	for _, file := range toc.Files {
+		content, err := os.ReadFile(file.FullPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		run.checkFile("/"+filepath.ToSlash(file.Path), filepath.Join(directory, file.Path), content)
+	}
+	if c.external {
+		run.checkExternal()
+	}
+
+	sort.SliceStable(run.diagnostics, func(i, j int) bool {
+		a, b := run.diagnostics[i], run.diagnostics[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return run.diagnostics, nil
+}
+
+// checkFile checks the links, images and wiki links of one file. A file
+// that fails to render is reported, the other files are still checked.
+func (run *checkRun) checkFile(urlPath string, file string, content []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			run.renderFailed(urlPath, r)
+		}
+	}()
+
+	// Rendering the page first reports documents that fail to render
+	run.pageAnchors(urlPath)
+
+	clean, _ := extractFrontmatter(content)
+	start := len(content) - len(clean)
+
+	// Links are taken from the parsed document and located in the source
+	// for the line numbers, in the order they appear. Reference links are
+	// found by their label, the definitions are not where they are used.
+	src := linkSource{content: content, cursor: start, definitions: referenceDefinitions(content, start)}
+	doc := parseMarkdown(clean, run.checker.parser.gfm)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		var destination, kind string
+		var references []string // How the link looks if it uses a reference
+		switch n := node.(type) {
+		case *ast.Link:
+			if n.NoteID != 0 {
+				return ast.GoToNext
+			}
+			destination, kind = string(n.Destination), KindLink
+			for _, label := range []string{string(n.DeferredID), nodeText(n)} {
+				if src.defined(label) {
+					references = append(references, "["+label+"]")
+				}
+			}
+		case *ast.Image:
+			destination, kind = string(n.Destination), KindImage
+			if src.definition(destination) >= 0 {
+				references = append(references, "!["+nodeText(n)+"]")
+			}
+		default:
+			return ast.GoToNext
+		}
+		run.checkLink(sourcePosition(file, content, src.locate(destination, references), destination), urlPath, destination, kind)
+		return ast.GoToNext
+	})
+
+	run.checkWikiLinks(urlPath, file, content, start)
+}
+
+// nodeText returns the text of a node without markup
+func nodeText(node ast.Node) string {
+	var sb strings.Builder
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if text, ok := n.(*ast.Text); ok && entering {
+			sb.Write(text.Literal)
+		}
+		return ast.GoToNext
+	})
+	return sb.String()
+}
+
+// Regex for link reference definitions like [label]: destination
+var referenceDefinitionRegex = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:`)
+
+// referenceDefinition is a line defining a link reference
+type referenceDefinition struct {
+	start, end int // Offsets of the line
+	label      string
+}
+
+// referenceDefinitions returns the lines of content from start on that
+// define link references, except in fenced code blocks
+func referenceDefinitions(content []byte, start int) []referenceDefinition {
+	var definitions []referenceDefinition
+	fence := ""
+	offset := start
+	for _, line := range strings.SplitAfter(string(content[start:]), "\n") {
+		lineStart := offset
+		offset += len(line)
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if m[1][0] == fence[0] && len(m[1]) >= len(fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := referenceDefinitionRegex.FindStringSubmatch(line); m != nil && fence == "" {
+			definitions = append(definitions, referenceDefinition{start: lineStart, end: offset, label: m[1]})
+		}
+	}
+	return definitions
+}
+
+// linkSource locates the links of a parsed document in its source
+type linkSource struct {
+	content     []byte
+	cursor      int // Offset after the previous link
+	definitions []referenceDefinition
+}
+
+// locate returns the offset of a link with the destination after the
+// previous link and moves past it. Links using a reference are found by
+// how they reference it, otherwise by the destination. A link that is not
+// found is reported at its definition or the previous link.
+func (src *linkSource) locate(destination string, references []string) int {
+	// The text found first is where the link is
+	offset, length := -1, 0
+	for _, text := range append(references, destination) {
+		if i := src.index(text); i >= 0 && (offset < 0 || i < offset) {
+			offset, length = i, len(text)
+		}
+	}
+	if offset >= 0 {
+		src.cursor = offset + length
+		return offset
+	}
+
+	if offset := src.definition(destination); offset >= 0 {
+		return offset
+	}
+	return src.cursor
+}
+
+// definition returns the offset of the destination in the reference
+// definition with it, or -1
+func (src *linkSource) definition(destination string) int {
+	if destination == "" {
+		return -1
+	}
+	for _, def := range src.definitions {
+		if i := bytes.Index(src.content[def.start:def.end], []byte(destination)); i >= 0 {
+			return def.start + i
+		}
+	}
+	return -1
+}
+
+// index returns the offset of the next occurrence of text after the cursor
+// outside of reference definitions, or -1
+func (src *linkSource) index(text string) int {
+	if text == "" {
+		return -1
+	}
+	for from := src.cursor; from < len(src.content); {
+		i := bytes.Index(src.content[from:], []byte(text))
+		if i < 0 {
+			return -1
+		}
+		offset := from + i
+		if !src.inDefinition(offset) {
+			return offset
+		}
+		from = offset + 1
+	}
+	return -1
+}
+
+// defined reports whether a reference with the label is defined, labels
+// are compared ignoring case
+func (src *linkSource) defined(label string) bool {
+	for _, def := range src.definitions {
+		if label != "" && strings.EqualFold(def.label, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDefinition reports whether an offset is in a reference definition
+func (src *linkSource) inDefinition(offset int) bool {
+	for _, def := range src.definitions {
+		if offset >= def.start && offset < def.end {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLink checks a link or image destination of the page at urlPath
+func (run *checkRun) checkLink(pos Diagnostic, urlPath string, destination string, kind string) {
+	switch {
+	case destination == "":
+		return
+	case strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "https://"):
+		if run.checker.external {
+			run.externals[destination] = append(run.externals[destination], pos)
+		}
+		return
+	case isExternalLink(destination):
+		return
+	}
+
+	target, fragment, _ := strings.Cut(destination, "#")
+	target, _, _ = strings.Cut(target, "?")
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+
+	targetPath := urlPath
+	if target != "" {
+		resolved, ok := resolveIncludePath(target, urlPath)
+		if !ok {
+			run.report(pos, kind, fmt.Sprintf("broken %s: points outside of the checked directory", kind))
+			return
+		}
+		info, err := os.Stat(filepath.Join(run.root, filepath.FromSlash(resolved)))
+		if err != nil {
+			run.report(pos, kind, fmt.Sprintf("broken %s: %s not found", kind, resolved))
+			return
+		}
+		// Only fragments of markdown files can be checked
+		if info.IsDir() || !isMarkdownPath(resolved) {
+			return
+		}
+		targetPath = resolved
+	}
+
+	if fragment != "" && !run.hasAnchor(targetPath, fragment) {
+		run.report(pos, KindAnchor, fmt.Sprintf("broken anchor: #%s not found in %s", fragment, targetPath))
+	}
+}
+
+// checkWikiLinks checks the [[wiki links]] of a file outside of code
+func (run *checkRun) checkWikiLinks(urlPath string, file string, content []byte, start int) {
+	for _, link := range findWikiLinks(content[start:]) {
+		if link.text == "_TOC_" {
+			continue
+		}
+		pos := sourcePosition(file, content, start+link.start, string(content[start+link.start:start+link.end]))
+
+		target, _, _ := strings.Cut(link.text, "|")
+		page, heading, hasHeading := strings.Cut(target, "#")
+		targetPath := urlPath
+		if page != "" {
+			resolved, found := run.links.resolve(page, urlPath)
+			if !found {
+				run.report(pos, KindWiki, fmt.Sprintf("broken wiki link: no page matches %q", page))
+				continue
+			}
+			targetPath = resolved
+		}
+		if hasHeading && !run.hasAnchor(targetPath, githubSlug(heading)) {
+			run.report(pos, KindWiki, fmt.Sprintf("broken wiki link: heading %q not found in %s", heading, targetPath))
+		}
+	}
+}
+
+// hasAnchor reports whether the page at urlPath has an element with the id
+// of the fragment, compared like the links of served pages
+func (run *checkRun) hasAnchor(urlPath string, fragment string) bool {
+	ids := run.pageAnchors(urlPath)
+	return ids[fragment] || ids[normalizeFragment(fragment)]
+}
+
+// pageAnchors returns the ids of the elements of the page at urlPath. A
+// page that fails to render is reported and has none.
+func (run *checkRun) pageAnchors(urlPath string) map[string]bool {
+	if ids, ok := run.anchors[urlPath]; ok {
+		return ids
+	}
+
+	ids := make(map[string]bool)
+	run.anchors[urlPath] = ids
+	defer func() {
+		if r := recover(); r != nil {
+			run.renderFailed(urlPath, r)
+		}
+	}()
+
+	content, err := os.ReadFile(filepath.Join(run.root, filepath.FromSlash(urlPath)))
+	if err == nil {
+		content, _ = expandIncludes(run.root, urlPath, content, run.links)
+		page := run.checker.parser.Render(preprocessWikiLinks(content, run.links, urlPath))
+		for _, m := range anchorRegex.FindAllSubmatch(page.HTML, -1) {
+			ids[string(m[1])] = true
+		}
+	}
+	return ids
+}
+
+// renderFailed reports a page that failed to render, once
+func (run *checkRun) renderFailed(urlPath string, r interface{}) {
+	if run.broken[urlPath] {
+		return
+	}
+	run.broken[urlPath] = true
+	pos := Diagnostic{File: filepath.Join(run.directory, filepath.FromSlash(urlPath)), Line: 1, Column: 1, Target: urlPath}
+	run.report(pos, KindRender, fmt.Sprintf("failed to render: %v", r))
+}
+
+// checkExternal requests every external link once, several at a time
+func (run *checkRun) checkExternal() {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxExternalChecks)
+	for link, uses := range run.externals {
+		wg.Add(1)
+		go func(link string, uses []Diagnostic) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			problem := run.checker.fetch(link)
+			if problem == "" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, pos := range uses {
+				run.report(pos, KindExternal, "broken external link: "+problem)
+			}
+		}(link, uses)
+	}
+	wg.Wait()
+}
+
+// fetch requests an external link and describes what is wrong with it, an
+// empty string means the link works. Servers not supporting HEAD get a GET.
+func (c *Checker) fetch(link string) string {
+	resp, err := c.request(http.MethodHead, link)
+	if err == nil && resp.StatusCode >= 400 {
+		resp.Body.Close()
+		resp, err = c.request(http.MethodGet, link)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return resp.Status
+	}
+	return ""
+}
+
+func (c *Checker) request(method string, link string) (*http.Response, error) {
+	req, err := http.NewRequest(method, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "go-grip")
+	return c.client.Do(req)
+}
+
+// report adds a diagnostic at pos
+func (run *checkRun) report(pos Diagnostic, kind string, message string) {
+	pos.Kind = kind
+	pos.Message = message
+	run.diagnostics = append(run.diagnostics, pos)
+}
+
+// sourcePosition returns a diagnostic for target at offset of content,
+// with 1-based line and column
+func sourcePosition(file string, content []byte, offset int, target string) Diagnostic {
+	before := content[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+	return Diagnostic{
+		File:   file,
+		Line:   bytes.Count(before, []byte("\n")) + 1,
+		Column: utf8.RuneCount(before[lineStart:]) + 1,
+		Target: target,
+	}
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCheckPositions(t *testing.T) {
+	root := t.TempDir()
+	content := "---\ntitle: Readme\n---\n" +
+		"See [one][ref] and ![logo][img].\n" +
+		"\n" +
+		"[two](missing2.md) and [ref] and [Three][].\n" +
+		"\n" +
+		"```\n[code](missing9.md)\n```\n" +
+		"\n" +
+		"[ref]: missing1.md\n" +
+		"[img]: missing.png\n" +
+		"[three]: missing3.md\n" +
+		"\n" +
+		"[four](missing1.md) and [[Missing Page]]\n"
+	if err := os.WriteFile(filepath.Join(root, "README.md"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics, err := NewChecker(NewParser("light")).Check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, fmt.Sprintf("%d:%d %s", d.Line, d.Column, d.Target))
+	}
+
+	want := []string{
+		"4:10 missing1.md",
+		"4:20 missing.png",
+		"6:7 missing2.md",
+		"6:24 missing1.md",
+		"6:34 missing3.md",
+		"16:8 missing1.md",
+		"16:25 [[Missing Page]]",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got diagnostics\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCheckEmptyListItem(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "README.md"), []byte("# Title\n\n* "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "other.md"), []byte("[back](README.md#title)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics, err := NewChecker(NewParser("light")).Check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diagnostics) != 0 {
+		t.Errorf("got diagnostics %v, want none", diagnostics)
+	}
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+
+	chroma_html "github.com/alecthomas/chroma/v2/formatters/html"
+)
+
+// Regex for the parts of a code block info string: key=value attributes,
+// {1,3-5} line ranges and single words like the language or linenos
+var codeInfoRegex = regexp.MustCompile(`([\w-]+)=("[^"]*"|'[^']*'|\S+)|\{[^}]*\}|\S+`)
+
+// codeBlockInfo holds the language and attributes of a fenced code block,
+// as in ```go title="main.go" {3-5} linenos
+type codeBlockInfo struct {
+	lang        string
+	title       string
+	highlight   [][2]int
+	lineNumbers bool
+	start       int
+	file        string // Source file the code is included from
+	lines       string // Line range of the source file, like 10-30
+	region      string // Region of the source file
+}
+
+// parseCodeInfo parses the info string of a fenced code block
+func parseCodeInfo(info string) codeBlockInfo {
+	var c codeBlockInfo
+	for i, m := range codeInfoRegex.FindAllStringSubmatch(info, -1) {
+		key, value := m[1], strings.Trim(m[2], `"'`)
+		switch {
+		case strings.HasPrefix(m[0], "{"):
+			c.highlight = append(c.highlight, parseLineRanges(strings.Trim(m[0], "{}"))...)
+		case key == "title" || key == "filename":
+			c.title = value
+		case key == "hl_lines" || key == "highlight":
+			c.highlight = append(c.highlight, parseLineRanges(value)...)
+		case key == "linenos" || key == "showLineNumbers":
+			c.lineNumbers = value != "false"
+		case key == "file":
+			c.file = value
+		case key == "lines":
+			c.lines = value
+		case key == "region":
+			c.region = value
+		case key == "linenostart" || key == "startLineNumber":
+			if n, err := strconv.Atoi(value); err == nil {
+				c.start = n
+				c.lineNumbers = true
+			}
+		case m[0] == "linenos" || m[0] == "showLineNumbers":
+			c.lineNumbers = true
+		case i == 0 && key == "":
+			c.lang = m[0]
+		}
+	}
+	return c
+}
+
+// parseLineRanges parses line ranges like 1,3-5 or 1 3-5
+func parseLineRanges(s string) [][2]int {
+	var ranges [][2]int
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			continue
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+// hasOptions reports whether the block needs more than plain highlighting
+func (c codeBlockInfo) hasOptions() bool {
+	return c.title != "" || len(c.highlight) > 0 || c.lineNumbers || c.file != ""
+}
+
+// formatterOptions returns the Chroma options for the attributes. Line
+// number ids get a prefix from the code, so blocks of a page differ.
+func (c codeBlockInfo) formatterOptions(code string) []chroma_html.Option {
+	options := []chroma_html.Option{chroma_html.WithClasses(true)}
+	if len(c.highlight) > 0 {
+		options = append(options, chroma_html.HighlightLines(c.highlight))
+	}
+	if c.lineNumbers {
+		h := fnv.New32a()
+		h.Write([]byte(code))
+		options = append(options,
+			chroma_html.WithLineNumbers(true),
+			chroma_html.WithLinkableLineNumbers(true, fmt.Sprintf("code-%x-L", h.Sum32())))
+		// Included lines keep their numbers from the source file
+		start := c.start
+		if from, _, _ := strings.Cut(c.lines, "-"); start == 0 && from != "" {
+			start, _ = strconv.Atoi(from)
+		}
+		if start > 0 {
+			options = append(options, chroma_html.BaseLineNumber(start))
+		}
+	}
+	return options
+}
+
+// titleHTML renders the file name header shown above the code. Code
+// included from a file links to it.
+func (c codeBlockInfo) titleHTML() string {
+	title := c.title
+	if title == "" {
+		title = c.file
+	}
+	if c.file == "" {
+		return fmt.Sprintf(`<div class="code-title">%s</div>`, template.HTMLEscapeString(title))
+	}
+	return fmt.Sprintf(`<div class="code-title"><a href="%s">%s</a></div>`,
+		template.HTMLEscapeString(escapePath(c.file)), template.HTMLEscapeString(title))
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	chroma_html "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/chrishrb/go-grip/defaults"
+)
+
+// Regex for the generated stylesheets of the Chroma styles
+var chromaCSSRegex = regexp.MustCompile(`^chroma-(.+)\.css$`)
+
+// Generated stylesheets by style name, a style never changes at runtime
+var (
+	cssCodeMu    sync.Mutex
+	cssCodeCache = map[string][]byte{}
+)
+
+// getCssCode returns the stylesheet of a Chroma style, generated once
+func getCssCode(style string) []byte {
+	cssCodeMu.Lock()
+	defer cssCodeMu.Unlock()
+	if css, ok := cssCodeCache[style]; ok {
+		return css
+	}
+	buf := new(bytes.Buffer)
+	formatter := chroma_html.New(chroma_html.WithClasses(true))
+	_ = formatter.WriteCSS(buf, styles.Get(style))
+	cssCodeCache[style] = buf.Bytes()
+	return buf.Bytes()
+}
+
+// readStaticFile reads a static file by its name below /static/, the
+// stylesheets of the Chroma styles included
+func readStaticFile(name string) ([]byte, error) {
+	if m := chromaCSSRegex.FindStringSubmatch(name); m != nil {
+		if _, ok := styles.Registry[m[1]]; !ok {
+			return nil, fmt.Errorf("unknown code style: %s", m[1])
+		}
+		return getCssCode(m[1]), nil
+	}
+	return defaults.StaticFiles.ReadFile("static/" + name)
+}
+
+// staticHandler serves the embedded static files and the stylesheets of the
+// Chroma styles at /static/chroma-<style>.css
+type staticHandler struct {
+	files http.Handler
+}
+
+func newStaticHandler() *staticHandler {
+	return &staticHandler{files: http.FileServer(http.FS(defaults.StaticFiles))}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if !chromaCSSRegex.MatchString(name) {
+		h.files.ServeHTTP(w, r)
+		return
+	}
+
+	css, err := readStaticFile(name)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	// The content only changes with the binary, the ETag covers upgrades
+	hash := fnv.New64a()
+	hash.Write(css)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, hash.Sum64()))
+	http.ServeContent(w, r, path.Base(name), time.Time{}, bytes.NewReader(css))
+}
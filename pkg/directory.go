@@ -7,15 +7,19 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // MarkdownFile represents a markdown file found during directory scanning
 type MarkdownFile struct {
-	Path         string // Relative path from the base directory
-	Title        string // File name without extension
-	FullPath     string // Absolute path to the file
-	IsIndex      bool   // True if this is a README.md or index.md
-	DirectoryLevel int  // How deep in the directory structure
+	Path           string // Relative path from the base directory
+	Title          string // Frontmatter title, first H1 or file name without extension
+	FullPath       string // Absolute path to the file
+	IsIndex        bool   // True if this is a README.md or index.md
+	DirectoryLevel int    // How deep in the directory structure
+	Hidden         bool   // Frontmatter draft or hidden, left out of the TOC
+	Weight         int    // Frontmatter weight, orders files within a directory
 }
 
 // DirectoryTOC represents the table of contents for a directory
@@ -26,8 +30,9 @@ type DirectoryTOC struct {
 	Readme    *MarkdownFile
 }
 
-// ScanMarkdownFiles recursively scans a directory for markdown files
-func ScanMarkdownFiles(basePath string) (*DirectoryTOC, error) {
+// ScanMarkdownFiles recursively scans a directory for markdown files. With
+// gfm, titles are read with the GitHub Flavored Markdown extensions.
+func ScanMarkdownFiles(basePath string, gfm bool) (*DirectoryTOC, error) {
 	toc := &DirectoryTOC{
 		BasePath: basePath,
 		Files:    []MarkdownFile{},
@@ -41,8 +46,7 @@ func ScanMarkdownFiles(basePath string) (*DirectoryTOC, error) {
 
 		// Skip hidden directories and .git
 		if d.IsDir() {
-			name := d.Name()
-			if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+			if path != basePath && skipDir(d.Name()) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -62,18 +66,24 @@ func ScanMarkdownFiles(basePath string) (*DirectoryTOC, error) {
 		// Calculate directory level
 		level := strings.Count(relPath, string(os.PathSeparator))
 
-		// Get title (filename without extension)
-		title := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
-		
+		// Get title from the content, falling back to the filename
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		meta := readFileMeta(path, info, gfm)
+
 		// Check if it's an index file
 		isIndex := strings.EqualFold(d.Name(), "README.md") || strings.EqualFold(d.Name(), "index.md")
 
 		mdFile := MarkdownFile{
-			Path:         relPath,
-			Title:        title,
-			FullPath:     path,
-			IsIndex:      isIndex,
+			Path:           relPath,
+			Title:          meta.title,
+			FullPath:       path,
+			IsIndex:        isIndex,
 			DirectoryLevel: level,
+			Hidden:         meta.hidden,
+			Weight:         meta.weight,
 		}
 
 		// Special handling for README.md in the root directory
@@ -96,12 +106,20 @@ func ScanMarkdownFiles(basePath string) (*DirectoryTOC, error) {
 		dirI := filepath.Dir(toc.Files[i].Path)
 		dirJ := filepath.Dir(toc.Files[j].Path)
 
-		// If same directory, sort by name (README/index first)
+		// If same directory, sort by weight, then by name (README/index
+		// first, files with a weight before those without)
 		if dirI == dirJ {
 			if toc.Files[i].IsIndex != toc.Files[j].IsIndex {
 				return toc.Files[i].IsIndex
 			}
-			return strings.ToLower(toc.Files[i].Title) < strings.ToLower(toc.Files[j].Title)
+			weightI, weightJ := toc.Files[i].Weight, toc.Files[j].Weight
+			if (weightI == 0) != (weightJ == 0) {
+				return weightI != 0
+			}
+			if weightI != weightJ {
+				return weightI < weightJ
+			}
+			return strings.ToLower(fileName(toc.Files[i].Path)) < strings.ToLower(fileName(toc.Files[j].Path))
 		}
 
 		// Otherwise sort by directory path
@@ -111,31 +129,88 @@ func ScanMarkdownFiles(basePath string) (*DirectoryTOC, error) {
 	return toc, nil
 }
 
+// Titles and settings of markdown files by absolute path. An entry is
+// valid as long as size and modification time of the file match.
+var metaCache = struct {
+	sync.Mutex
+	entries map[string]fileMeta
+}{entries: make(map[string]fileMeta)}
+
+// fileMeta holds what the directory listing needs to know about a file
+type fileMeta struct {
+	size    int64
+	modTime time.Time
+	gfm     bool // Whether the title was read with the gfm extensions
+	title   string
+	hidden  bool
+	weight  int
+}
+
+// readFileMeta returns the title, visibility and weight of a markdown file
+func readFileMeta(fullPath string, info fs.FileInfo, gfm bool) fileMeta {
+	metaCache.Lock()
+	cached, ok := metaCache.entries[fullPath]
+	metaCache.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) && cached.gfm == gfm {
+		return cached
+	}
+
+	meta := fileMeta{size: info.Size(), modTime: info.ModTime(), gfm: gfm, title: fileName(fullPath)}
+	if content, err := os.ReadFile(fullPath); err == nil {
+		cleanContent, frontmatter := extractFrontmatter(content)
+		if t := documentTitle(frontmatter, collectHeadings(parseMarkdown(cleanContent, gfm))); t != "" {
+			meta.title = t
+		}
+		page := frontmatterMeta(frontmatter)
+		meta.hidden = page.Hidden
+		meta.weight = page.Weight
+	}
+
+	metaCache.Lock()
+	metaCache.entries[fullPath] = meta
+	metaCache.Unlock()
+	return meta
+}
+
+// fileName returns the name of a file without directory and extension
+func fileName(p string) string {
+	base := filepath.Base(p)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
 // GenerateTOCMarkdown generates markdown content for the directory TOC
 func GenerateTOCMarkdown(toc *DirectoryTOC) string {
 	var sb strings.Builder
 
 	// Title
 	sb.WriteString("# 📁 Directory Contents\n\n")
-	
+
 	// Show base path
 	sb.WriteString(fmt.Sprintf("**Base Path:** `%s`\n\n", toc.BasePath))
-	
+
+	// Drafts and hidden files are not listed
+	var files []MarkdownFile
+	for _, file := range toc.Files {
+		if !file.Hidden {
+			files = append(files, file)
+		}
+	}
+
 	// Statistics
-	sb.WriteString(fmt.Sprintf("**Total Markdown Files:** %d\n\n", len(toc.Files)))
-	
+	sb.WriteString(fmt.Sprintf("**Total Markdown Files:** %d\n\n", len(files)))
+
 	// Separator
 	sb.WriteString("---\n\n")
 
 	// If there's a README in the root, show it prominently
-	if toc.HasReadme && toc.Readme != nil {
+	if toc.HasReadme && toc.Readme != nil && !toc.Readme.Hidden {
 		sb.WriteString("## 📄 Main Documentation\n\n")
-		sb.WriteString(fmt.Sprintf("- [**%s**](%s) (Project README)\n\n", toc.Readme.Title, "/"+filepath.ToSlash(toc.Readme.Path)))
+		sb.WriteString(fmt.Sprintf("- [**%s**](%s) (Project README)\n\n", escapeMarkdown(toc.Readme.Title), filepath.ToSlash(toc.Readme.Path)))
 	}
 
 	// Group files by directory
 	filesByDir := make(map[string][]MarkdownFile)
-	for _, file := range toc.Files {
+	for _, file := range files {
 		dir := filepath.Dir(file.Path)
 		filesByDir[dir] = append(filesByDir[dir], file)
 	}
@@ -149,39 +224,39 @@ func GenerateTOCMarkdown(toc *DirectoryTOC) string {
 
 	// Generate TOC grouped by directory
 	sb.WriteString("## 📚 All Markdown Files\n\n")
-	
+
 	for _, dir := range dirs {
 		files := filesByDir[dir]
-		
+
 		// Directory header
 		if dir == "." {
 			sb.WriteString("### 📂 Root Directory\n\n")
 		} else {
 			// Clean up the directory path for display
 			displayDir := filepath.ToSlash(dir)
-			sb.WriteString(fmt.Sprintf("### 📂 %s\n\n", displayDir))
+			sb.WriteString(fmt.Sprintf("### 📂 %s\n\n", escapeMarkdown(displayDir)))
 		}
 
 		// List files in this directory
 		for _, file := range files {
 			// Indent based on file name
 			indent := ""
-			
-			// Create the link - use forward slashes for web paths
-			webPath := "/" + filepath.ToSlash(file.Path)
-			
+
+			// Create the link relative to the listed directory - use forward slashes for web paths
+			webPath := filepath.ToSlash(file.Path)
+
 			// Add emoji for different file types
 			emoji := "📄"
 			if file.IsIndex {
 				emoji = "📖"
 			}
-			
+
 			// Format the title
-			displayTitle := file.Title
+			displayTitle := escapeMarkdown(file.Title)
 			if file.IsIndex {
 				displayTitle = fmt.Sprintf("**%s**", displayTitle)
 			}
-			
+
 			sb.WriteString(fmt.Sprintf("%s- %s [%s](%s)\n", indent, emoji, displayTitle, webPath))
 		}
 		sb.WriteString("\n")
@@ -191,9 +266,25 @@ func GenerateTOCMarkdown(toc *DirectoryTOC) string {
 	sb.WriteString("---\n\n")
 	sb.WriteString("## 🔍 Navigation Tips\n\n")
 	sb.WriteString("- Click any file name to view its rendered content\n")
-	sb.WriteString("- Use your browser's back button to return to this index\n")
+	sb.WriteString("- Use the sidebar, the breadcrumbs or the previous and next links to move between pages\n")
 	sb.WriteString("- Files are organized by directory structure\n")
 	sb.WriteString("- **Bold** entries are README or index files\n")
 
 	return sb.String()
-}
\ No newline at end of file
+}
+
+// GenerateMountsMarkdown generates markdown content for the landing page of
+// a server hosting several documentation roots
+func GenerateMountsMarkdown(mounts []Mount) string {
+	var sb strings.Builder
+
+	sb.WriteString("# 📚 Documentation Hub\n\n")
+	sb.WriteString(fmt.Sprintf("**Mounted Directories:** %d\n\n", len(mounts)))
+	sb.WriteString("---\n\n")
+
+	for _, m := range mounts {
+		sb.WriteString(fmt.Sprintf("- 📂 [**%s**](%s/) `%s`\n", escapeMarkdown(m.Name), escapePath("/"+m.Name), m.Directory))
+	}
+
+	return sb.String()
+}
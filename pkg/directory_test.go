@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTOCMarkdownTitles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"README.md":    "# Read [me] first\n",
+		"guide.md":     "---\ntitle: \"Setup *fast*](evil.md)\"\n---\n",
+		"dir_x/faq.md": "---\ntitle: \"<b>FAQ</b> _and_ `code`\"\n---\n",
+	}
+	for name, content := range files {
+		full := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	toc, err := ScanMarkdownFiles(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(NewParser("light").MdToHTML([]byte(GenerateTOCMarkdown(toc))))
+
+	for _, want := range []string{
+		`<a href="README.md"><strong>Read [me] first</strong></a>`,
+		`<a href="guide.md">Setup *fast*](evil.md)</a>`,
+		"<a href=\"dir_x/faq.md\">&lt;b&gt;FAQ&lt;/b&gt; _and_ `code`</a>",
+		`dir_x</h3>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("table of contents does not contain %s:\n%s", want, out)
+		}
+	}
+}
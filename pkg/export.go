@@ -0,0 +1,303 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chrishrb/go-grip/defaults"
+)
+
+var (
+	// Regex for absolute links to markdown files produced by resolveMarkdownLinks
+	exportLinkRegex = regexp.MustCompile(`href="(/[^"#]*\.md)(#[^"]*)?"`)
+	// Regex for images and other embedded resources
+	exportSrcRegex = regexp.MustCompile(`src="([^"]+)"`)
+)
+
+// Exporter renders a directory of markdown files to a static html site
+// with the look of the live preview
+type Exporter struct {
+	parser      *Parser
+	theme       string
+	boundingBox bool
+}
+
+func NewExporter(theme string, boundingBox bool, parser *Parser) *Exporter {
+	return &Exporter{
+		parser:      parser,
+		theme:       theme,
+		boundingBox: boundingBox,
+	}
+}
+
+// Export renders every markdown file below directory into outDir. Each
+// directory gets an index.html with its table of contents, the embedded
+// static files and all referenced local images are copied alongside.
+func (e *Exporter) Export(directory string, outDir string) error {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	toc, err := ScanMarkdownFiles(directory, e.parser.gfm)
+	if err != nil {
+		return err
+	}
+
+	// Collect every directory that contains markdown files, including parents
+	dirs := map[string]bool{"/": true}
+	assets := map[string]bool{}
+	links := newWikiIndex(directory, e.parser.gfm)
+	graph := newLinkGraph(directory, e.parser, links)
+
+	// Render all pages before writing any, so a document that fails to
+	// render does not leave a partial export behind
+	pages := make([]RenderResult, len(toc.Files))
+	for i, file := range toc.Files {
+		urlPath := "/" + filepath.ToSlash(file.Path)
+		for d := path.Dir(urlPath); d != "/"; d = path.Dir(d) {
+			dirs[d] = true
+		}
+
+		content, err := os.ReadFile(file.FullPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+
+		page, deps, err := e.renderFile(directory, urlPath, content, links)
+		if err != nil {
+			return err
+		}
+		// Source files of included code are linked from the page
+		for _, dep := range deps {
+			if !isMarkdownPath(dep) {
+				assets[dep] = true
+			}
+		}
+		for _, asset := range localAssets(page.HTML, urlPath) {
+			assets[asset] = true
+		}
+		pages[i] = page
+	}
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for i, file := range toc.Files {
+		urlPath := "/" + filepath.ToSlash(file.Path)
+		nav := exportNavigation(toc, urlPath, urlPath)
+		if err := e.writePage(outDir, urlPath, pages[i], nav, exportBacklinks(graph, urlPath)); err != nil {
+			return err
+		}
+	}
+
+	// Write a table of contents for every directory, an index.md takes precedence
+	for d := range dirs {
+		if _, err := os.Stat(filepath.Join(directory, filepath.FromSlash(d), "index.md")); err == nil {
+			continue
+		}
+		sub, err := ScanMarkdownFiles(filepath.Join(directory, filepath.FromSlash(d)), e.parser.gfm)
+		if err != nil {
+			return err
+		}
+		indexPath := path.Join(d, "index.html")
+		page := e.parser.Render([]byte(GenerateTOCMarkdown(sub)))
+		page.HTML = resolveMarkdownLinks(page.HTML, indexPath, "")
+		nav := exportNavigation(toc, strings.TrimSuffix(d, "/")+"/", indexPath)
+		if err := e.writePage(outDir, indexPath, page, nav, nil); err != nil {
+			return err
+		}
+	}
+
+	if err := copyStaticFiles(outDir); err != nil {
+		return err
+	}
+	for _, style := range []string{e.parser.codeStyleLight, e.parser.codeStyleDark} {
+		dst := filepath.Join(outDir, "static", "chroma-"+style+".css")
+		if err := os.WriteFile(dst, getCssCode(style), 0o644); err != nil {
+			return err
+		}
+	}
+
+	// Copy referenced images, sorted for stable log output
+	var sorted []string
+	for asset := range assets {
+		sorted = append(sorted, asset)
+	}
+	sort.Strings(sorted)
+	for _, asset := range sorted {
+		src := filepath.Join(directory, filepath.FromSlash(asset))
+		dst := filepath.Join(outDir, filepath.FromSlash(asset))
+		if err := copyFile(src, dst); err != nil {
+			log.Printf("Skipping asset %s: %v", asset, err)
+		}
+	}
+
+	fmt.Printf("📦 Exported %d files to %s\n", len(toc.Files), outDir)
+	return nil
+}
+
+// renderFile renders a markdown file of the export and returns the URL
+// paths of the files it includes. A document that fails to render is
+// returned as an error naming the file.
+func (e *Exporter) renderFile(root string, urlPath string, content []byte, links *wikiIndex) (page RenderResult, deps []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to render %s: %v", urlPath, r)
+		}
+	}()
+
+	content, deps = expandIncludes(root, urlPath, content, links)
+	page = e.parser.Render(preprocessWikiLinks(content, links, urlPath))
+	page.HTML = resolveMarkdownLinks(page.HTML, urlPath, "")
+	return page, deps, nil
+}
+
+// writePage renders the page layout and writes it to the html file matching
+// urlPath. Links are rewritten relative to the page so the export works
+// from any base URL and from the file system.
+func (e *Exporter) writePage(outDir string, urlPath string, rendered RenderResult, nav *navigation, backlinks []navLink) error {
+	htmlPath := strings.TrimSuffix(urlPath, path.Ext(urlPath)) + ".html"
+	pageDir := path.Dir(htmlPath)
+
+	htmlContent := exportLinkRegex.ReplaceAllFunc(rendered.HTML, func(match []byte) []byte {
+		submatch := exportLinkRegex.FindSubmatch(match)
+		target := strings.TrimSuffix(string(submatch[1]), path.Ext(string(submatch[1]))) + ".html"
+		return []byte(fmt.Sprintf(`href="%s%s"`, relativeURL(pageDir, target), submatch[2]))
+	})
+
+	var buf bytes.Buffer
+	err := renderTemplate(&buf, htmlStruct{
+		Content:        string(htmlContent),
+		Title:          pageTitle(rendered, urlPath),
+		Description:    rendered.Description,
+		Layout:         rendered.Layout,
+		Theme:          e.theme,
+		BoundingBox:    e.boundingBox,
+		CodeStyleLight: e.parser.codeStyleLight,
+		CodeStyleDark:  e.parser.codeStyleDark,
+		Path:           urlPath,
+		Nav:            nav,
+		Headings:       rendered.Headings,
+		Backlinks:      backlinks,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %w", urlPath, err)
+	}
+
+	// The layout, emojis and mermaid reference the embedded files absolutely
+	page := staticLinkRegex.ReplaceAll(buf.Bytes(), []byte(`$1="`+relativeURL(pageDir, "/static/")))
+
+	dst := filepath.Join(outDir, filepath.FromSlash(htmlPath))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, page, 0o644)
+}
+
+// exportNavigation builds the navigation of the page current, written to
+// urlPath, with links relative to the page. Directories link to their
+// index.html.
+func exportNavigation(toc *DirectoryTOC, current string, urlPath string) *navigation {
+	pageDir := path.Dir(urlPath)
+	return buildNavigation(toc, current, func(p string) string {
+		target := p + "index.html"
+		if !strings.HasSuffix(p, "/") {
+			target = strings.TrimSuffix(p, path.Ext(p)) + ".html"
+		}
+		return escapePath(relativeURL(pageDir, target))
+	})
+}
+
+// exportBacklinks returns links to the pages linking to urlPath, relative
+// to the page
+func exportBacklinks(graph *linkGraph, urlPath string) []navLink {
+	var links []navLink
+	for _, b := range graph.backlinks(urlPath) {
+		target := strings.TrimSuffix(b.Path, path.Ext(b.Path)) + ".html"
+		links = append(links, navLink{Title: b.Title, Href: escapePath(relativeURL(path.Dir(urlPath), target))})
+	}
+	return links
+}
+
+// localAssets returns the URL paths of local files embedded by a page
+func localAssets(htmlContent []byte, urlPath string) []string {
+	var assets []string
+	for _, m := range exportSrcRegex.FindAllSubmatch(htmlContent, -1) {
+		src := string(m[1])
+		if isExternalLink(src) || strings.HasPrefix(src, "/static/") {
+			continue
+		}
+		src, _, _ = strings.Cut(src, "?")
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		if !strings.HasPrefix(src, "/") {
+			src = path.Join(path.Dir(urlPath), src)
+		}
+		assets = append(assets, path.Clean(src))
+	}
+	return assets
+}
+
+// relativeURL returns the URL of target relative to the directory fromDir,
+// both given as absolute URL paths
+func relativeURL(fromDir string, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(fromDir), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasSuffix(target, "/") {
+		rel += "/"
+	}
+	return rel
+}
+
+// copyStaticFiles copies the embedded static files into outDir
+func copyStaticFiles(outDir string) error {
+	return fs.WalkDir(defaults.StaticFiles, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(outDir, filepath.FromSlash(p))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0o755)
+		}
+		data, err := defaults.StaticFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0o644)
+	})
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
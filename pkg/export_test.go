@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportEmptyListItem(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "README.md"), []byte("# Title\n\n* "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	if err := NewExporter("light", false, NewParser("light")).Export(root, out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "README.html")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInlineLocalImages(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"img/logo.png", "docs/diagram.png"} {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Absolute paths resolve against the root, relative ones against the
+	// document directory
+	got := string(inlineLocalImages([]byte(`<img src="/img/logo.png"><img src="diagram.png">`), root, filepath.Join(root, "docs")))
+	want := `<img src="data:image/png;base64,aW1nL2xvZ28ucG5n"><img src="data:image/png;base64,ZG9jcy9kaWFncmFtLnBuZw==">`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,294 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// How the frontmatter of a document is shown above its content
+const (
+	FrontmatterHidden      = "hidden"
+	FrontmatterTable       = "table"
+	FrontmatterCollapsible = "collapsible"
+)
+
+// Page layouts selected with the frontmatter key layout
+var layouts = []string{"default", "wide", "plain"}
+
+// Frontmatter keys that only change how the page behaves and are not shown
+var behaviourKeys = []string{"draft", "hidden", "weight", "layout", "toc"}
+
+// pageMeta holds the frontmatter keys that change how a page is shown
+type pageMeta struct {
+	Description string
+	Tags        []string
+	Hidden      bool   // draft or hidden, left out of the navigation
+	Weight      int    // Pages with a weight come first, lowest first
+	Layout      string // Empty for the default layout
+	Outline     bool   // False with toc: false
+}
+
+// frontmatterMeta reads the page settings from the frontmatter
+func frontmatterMeta(frontmatter Frontmatter) pageMeta {
+	meta := pageMeta{
+		Tags:    frontmatterTags(frontmatter),
+		Hidden:  frontmatterBool(frontmatter, "draft", false) || frontmatterBool(frontmatter, "hidden", false),
+		Weight:  frontmatterInt(frontmatter, "weight"),
+		Outline: frontmatterBool(frontmatter, "toc", true),
+	}
+	if description, ok := frontmatter["description"].(string); ok {
+		meta.Description = strings.TrimSpace(description)
+	}
+	if layout, ok := frontmatter["layout"].(string); ok && layout != "default" {
+		meta.Layout = layout
+	}
+	return meta
+}
+
+// pageLayout returns the layout of a page, unknown layouts fall back to
+// the default one
+func pageLayout(meta pageMeta) string {
+	if meta.Layout != "" && !slices.Contains(layouts, meta.Layout) {
+		log.Println("Warning: Unknown layout ", meta.Layout, ", using the default")
+		return ""
+	}
+	return meta.Layout
+}
+
+// frontmatterBool returns a boolean frontmatter value, or def if the key
+// is missing or not a boolean
+func frontmatterBool(frontmatter Frontmatter, key string, def bool) bool {
+	switch v := frontmatter[key].(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// frontmatterInt returns a numeric frontmatter value, or 0 if the key is
+// missing or not a number
+func frontmatterInt(frontmatter Frontmatter, key string) int {
+	switch v := frontmatter[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	}
+	return 0
+}
+
+// utf8BOM is the byte order mark some editors write at the start of files
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// extractFrontmatter extracts the frontmatter from markdown content. The
+// returned content is a suffix of content. Invalid frontmatter is kept in
+// the content without error, splitFrontmatter returns it.
+func extractFrontmatter(content []byte) ([]byte, Frontmatter) {
+	cleanContent, frontmatter, _ := splitFrontmatter(content)
+	return cleanContent, frontmatter
+}
+
+// splitFrontmatter splits markdown content into the content after the
+// frontmatter and the parsed frontmatter. YAML is enclosed in ---, TOML in
+// +++ and JSON is an object at the start of the content that ends with a
+// line holding just }. A byte order mark
+// is skipped. Frontmatter that fails to parse stays in the content, a YAML
+// block that is no mapping, like a setext heading between thematic breaks,
+// and text starting with a brace that is no JSON object are not
+// frontmatter at all.
+func splitFrontmatter(content []byte) ([]byte, Frontmatter, error) {
+	content = bytes.TrimPrefix(content, utf8BOM)
+
+	var frontmatter Frontmatter
+	switch {
+	case bytes.HasPrefix(content, []byte("---")):
+		block, rest, ok := frontmatterBlock(content, "---")
+		if !ok {
+			return content, nil, nil
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(block, &doc); err != nil {
+			return content, nil, fmt.Errorf("invalid YAML frontmatter: %w", err)
+		}
+		if len(doc.Content) == 0 {
+			// An empty block is empty frontmatter
+			return rest, nil, nil
+		}
+		if doc.Content[0].Kind != yaml.MappingNode {
+			return content, nil, nil
+		}
+		if err := doc.Decode(&frontmatter); err != nil {
+			return content, nil, fmt.Errorf("invalid YAML frontmatter: %w", err)
+		}
+		return rest, frontmatter, nil
+	case bytes.HasPrefix(content, []byte("+++")):
+		block, rest, ok := frontmatterBlock(content, "+++")
+		if !ok {
+			return content, nil, nil
+		}
+		if err := toml.Unmarshal(block, &frontmatter); err != nil {
+			return content, nil, fmt.Errorf("invalid TOML frontmatter: %w", err)
+		}
+		return rest, frontmatter, nil
+	case bytes.HasPrefix(content, []byte("{")) && !bytes.HasPrefix(content, []byte("{{")):
+		// Like in Hugo, the object ends with a line holding just }. Text
+		// that merely starts with a brace is no frontmatter.
+		_, next, ok := findLine(content, 0, "}")
+		if !ok {
+			return content, nil, nil
+		}
+		if err := json.Unmarshal(content[:next], &frontmatter); err != nil {
+			return content, nil, nil
+		}
+		return content[next:], frontmatter, nil
+	}
+	return content, nil, nil
+}
+
+// frontmatterBlock returns the lines between a first line consisting of
+// delim and the next such line, and the content after the closing line
+func frontmatterBlock(content []byte, delim string) ([]byte, []byte, bool) {
+	start := bytes.IndexByte(content, '\n')
+	if start < 0 || string(bytes.TrimSpace(content[:start])) != delim {
+		return nil, nil, false
+	}
+	end, next, ok := findLine(content, start+1, delim)
+	if !ok {
+		return nil, nil, false
+	}
+	return content[start+1 : end], content[next:], true
+}
+
+// findLine returns the offsets of the first line from offset on that
+// consists of line, ignoring surrounding whitespace, and of the line after
+func findLine(content []byte, offset int, line string) (int, int, bool) {
+	for i := offset; i < len(content); {
+		next := len(content)
+		if end := bytes.IndexByte(content[i:], '\n'); end >= 0 {
+			next = i + end + 1
+		}
+		if string(bytes.TrimSpace(content[i:next])) == line {
+			return i, next, true
+		}
+		i = next
+	}
+	return 0, 0, false
+}
+
+// frontmatterError renders invalid frontmatter as a visible caution
+func frontmatterError(err error) []byte {
+	start, tmplErr := createBlockquoteStart("caution")
+	if tmplErr != nil {
+		log.Println("Error:", tmplErr)
+	}
+	return []byte(start + "<p>" + template.HTMLEscapeString(err.Error()) + "</p></div>")
+}
+
+// renderFrontmatter renders the frontmatter as a table, optionally inside a
+// collapsible box. Keys are sorted, so the rows keep their order.
+func renderFrontmatter(frontmatter Frontmatter, display string) []byte {
+	if display == FrontmatterHidden {
+		return nil
+	}
+
+	var keys []string
+	for key := range frontmatter {
+		if !slices.Contains(behaviourKeys, key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	if display == FrontmatterCollapsible {
+		sb.WriteString(`<details class="frontmatter"><summary>Document Information</summary>`)
+	} else {
+		sb.WriteString(`<div class="frontmatter"><div class="frontmatter-title">Document Information</div>`)
+	}
+
+	sb.WriteString(`<table class="frontmatter-table">`)
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf(`<tr><th scope="row">%s</th><td>`, template.HTMLEscapeString(key)))
+		if key == "tags" {
+			for _, tag := range frontmatterTags(frontmatter) {
+				sb.WriteString(fmt.Sprintf(`<span class="frontmatter-tag">%s</span>`, template.HTMLEscapeString(tag)))
+			}
+		} else {
+			sb.WriteString(template.HTMLEscapeString(formatFrontmatterValue(frontmatter[key])))
+		}
+		sb.WriteString(`</td></tr>`)
+	}
+	sb.WriteString(`</table>`)
+
+	if display == FrontmatterCollapsible {
+		sb.WriteString(`</details>`)
+	} else {
+		sb.WriteString(`</div>`)
+	}
+	return []byte(sb.String())
+}
+
+// formatFrontmatterValue formats a frontmatter value as text, lists are
+// comma separated and nested keys sorted
+func formatFrontmatterValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, formatFrontmatterValue(item))
+		}
+		return strings.Join(items, ", ")
+	case map[string]interface{}:
+		var items []string
+		for k, val := range v {
+			items = append(items, fmt.Sprintf("%s: %s", k, formatFrontmatterValue(val)))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ", ")
+	case Frontmatter:
+		// Nested maps get the type of the frontmatter
+		return formatFrontmatterValue(map[string]interface{}(v))
+	case map[interface{}]interface{}:
+		var items []string
+		for k, val := range v {
+			items = append(items, fmt.Sprintf("%v: %s", k, formatFrontmatterValue(val)))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ", ")
+	case time.Time:
+		// Dates without time are written as dates
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
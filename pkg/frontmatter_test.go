@@ -0,0 +1,42 @@
+package pkg
+
+import "testing"
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		rest    string
+		title   string
+		wantErr bool
+	}{
+		{"yaml", "---\ntitle: Guide\n---\n# Body\n", "# Body\n", "Guide", false},
+		{"toml", "+++\ntitle = \"Guide\"\n+++\n# Body\n", "# Body\n", "Guide", false},
+		{"json", "{\n  \"title\": \"Guide\"\n}\n# Body\n", "# Body\n", "Guide", false},
+		{"byte order mark", "\xef\xbb\xbf---\ntitle: Guide\n---\n# Body\n", "# Body\n", "Guide", false},
+		{"empty yaml", "---\n---\n# Body\n", "# Body\n", "", false},
+		{"no frontmatter", "# Body\n", "# Body\n", "", false},
+		{"unclosed yaml", "---\ntitle: Guide\n", "---\ntitle: Guide\n", "", false},
+		{"setext heading between thematic breaks", "---\nfoo\n---\n", "---\nfoo\n---\n", "", false},
+		{"invalid yaml", "---\ntitle: [bad\n---\n# Body\n", "---\ntitle: [bad\n---\n# Body\n", "", true},
+		{"invalid toml", "+++\ntitle =\n+++\n# Body\n", "+++\ntitle =\n+++\n# Body\n", "", true},
+		{"invalid json", "{\"title\": \"Guide\",\n# Body\n}\nafter\n", "{\"title\": \"Guide\",\n# Body\n}\nafter\n", "", false},
+		{"brace text", "{curly} braces\n", "{curly} braces\n", "", false},
+		{"one line json", "{\"title\": \"Guide\"}\n# Body\n", "{\"title\": \"Guide\"}\n# Body\n", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, frontmatter, err := splitFrontmatter([]byte(tt.content))
+			if string(rest) != tt.rest {
+				t.Errorf("content = %q, want %q", rest, tt.rest)
+			}
+			if title, _ := frontmatter["title"].(string); title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
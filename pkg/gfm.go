@@ -0,0 +1,198 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// gfmExtensions are the parser extensions of the GFM conformance mode
+const gfmExtensions = parser.Footnotes | parser.DefinitionLists
+
+var (
+	// Regex for GFM extended www autolinks, which start at the beginning of
+	// a line, after whitespace or after one of the delimiters *, _, ~ and (
+	wwwLinkRegex = regexp.MustCompile(`(?i)(^|[\s*_~(])(www\.[^\s<]+)`)
+	// Regex for an entity reference at the end of a link
+	trailingEntityRegex = regexp.MustCompile(`&[a-zA-Z0-9]+;$`)
+)
+
+// autolinkWWW turns bare www. links in text into links like GitHub does.
+// gomarkdown only detects links starting with a protocol.
+func autolinkWWW(doc ast.Node) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Link, *ast.Image, *ast.CodeBlock, *ast.Code, *ast.HTMLBlock:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering && wwwLinkRegex.Match(n.Literal) {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+
+	// Split the text nodes after walking, the walk must not see new nodes
+	for _, text := range texts {
+		parent := text.GetParent()
+		var children []ast.Node
+		for _, child := range parent.GetChildren() {
+			if child != text {
+				children = append(children, child)
+				continue
+			}
+			for _, n := range splitWWWLinks(text.Literal) {
+				n.SetParent(parent)
+				children = append(children, n)
+			}
+		}
+		parent.SetChildren(children)
+	}
+}
+
+// splitWWWLinks splits text into text and link nodes
+func splitWWWLinks(literal []byte) []ast.Node {
+	var nodes []ast.Node
+	start := 0
+	for _, m := range wwwLinkRegex.FindAllSubmatchIndex(literal, -1) {
+		link := trimAutolink(string(literal[m[4]:m[5]]))
+		if !validWWWDomain(link) {
+			continue
+		}
+		if m[4] > start {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: literal[start:m[4]]}})
+		}
+		node := &ast.Link{Destination: []byte("http://" + link)}
+		ast.AppendChild(node, &ast.Text{Leaf: ast.Leaf{Literal: []byte(link)}})
+		nodes = append(nodes, node)
+		start = m[4] + len(link)
+	}
+	if start < len(literal) {
+		nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: literal[start:]}})
+	}
+	return nodes
+}
+
+// trimAutolink removes trailing punctuation, unbalanced closing parentheses
+// and entity references that GFM does not count as part of a link
+func trimAutolink(link string) string {
+	for {
+		trimmed := strings.TrimRight(link, "?!.,:*_~")
+		if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+			trimmed = strings.TrimSuffix(trimmed, ")")
+		}
+		if loc := trailingEntityRegex.FindStringIndex(trimmed); loc != nil {
+			trimmed = trimmed[:loc[0]]
+		}
+		if trimmed == link {
+			return link
+		}
+		link = trimmed
+	}
+}
+
+// validWWWDomain checks the domain of a www. link: segments of letters,
+// digits, underscores and hyphens, without underscores in the last two
+func validWWWDomain(link string) bool {
+	domain := link
+	if i := strings.IndexAny(link, "/?#"); i >= 0 {
+		domain = link[:i]
+	}
+	segments := strings.Split(domain, ".")
+	if len(segments) < 2 {
+		return false
+	}
+	for i, segment := range segments {
+		if segment == "" && i != len(segments)-1 {
+			return false
+		}
+		for _, r := range segment {
+			if !(r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r > 127) {
+				return false
+			}
+		}
+		if i >= len(segments)-2 && strings.Contains(segment, "_") {
+			return false
+		}
+	}
+	return true
+}
+
+// renderHookFootnote renders footnote references and the footnote list with
+// the markup of GitHub, including links back to the references
+func renderHookFootnote(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	var err error
+	status := ast.GoToNext
+	switch n := node.(type) {
+	case *ast.Link:
+		if n.NoteID == 0 {
+			return ast.GoToNext, false
+		}
+		if entering {
+			slug := html.Slugify(n.Destination)
+			_, err = fmt.Fprintf(w, `<sup><a href="#fn-%s" id="fnref-%s" data-footnote-ref aria-describedby="footnote-label">%d</a></sup>`, slug, slug, n.NoteID)
+		}
+		status = ast.SkipChildren
+	case *ast.List:
+		if !n.IsFootnotesList {
+			return ast.GoToNext, false
+		}
+		if entering {
+			_, err = io.WriteString(w, `<section data-footnotes class="footnotes"><h2 id="footnote-label" class="sr-only">Footnotes</h2>`+"\n<ol>\n")
+		} else {
+			_, err = io.WriteString(w, "</ol>\n</section>\n")
+		}
+	case *ast.ListItem:
+		if n.RefLink == nil {
+			return ast.GoToNext, false
+		}
+		// Single line footnotes have their text without a paragraph
+		slug := html.Slugify(n.RefLink)
+		_, hasParagraph := ast.GetLastChild(n).(*ast.Paragraph)
+		switch {
+		case entering && hasParagraph:
+			_, err = fmt.Fprintf(w, `<li id="fn-%s">`, slug)
+		case entering:
+			_, err = fmt.Fprintf(w, `<li id="fn-%s"><p>`, slug)
+		case hasParagraph:
+			_, err = io.WriteString(w, "</li>\n")
+		default:
+			_, err = fmt.Fprintf(w, "%s</p></li>\n", footnoteBackref(n))
+		}
+	case *ast.Paragraph:
+		// The back reference goes at the end of the last paragraph
+		item, ok := n.GetParent().(*ast.ListItem)
+		if !ok || item.RefLink == nil || ast.GetLastChild(item) != n {
+			return ast.GoToNext, false
+		}
+		if entering {
+			_, err = io.WriteString(w, "<p>")
+		} else {
+			_, err = fmt.Fprintf(w, "%s</p>\n", footnoteBackref(item))
+		}
+	default:
+		return ast.GoToNext, false
+	}
+	if err != nil {
+		log.Println("Error:", err)
+	}
+	return status, true
+}
+
+// footnoteBackref returns the link from a footnote back to its reference
+func footnoteBackref(item *ast.ListItem) string {
+	number := 0
+	for i, child := range item.GetParent().GetChildren() {
+		if child == item {
+			number = i + 1
+		}
+	}
+	return fmt.Sprintf(` <a href="#fnref-%s" class="data-footnote-backref" data-footnote-backref aria-label="Back to reference %d">↩</a>`, html.Slugify(item.RefLink), number)
+}
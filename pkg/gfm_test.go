@@ -0,0 +1,313 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// The examples of the GitHub Flavored Markdown spec, testdata/gfm-spec.txt
+// from github.com/github/cmark-gfm, are rendered in GFM mode and compared
+// with the expected html after normalizing both. Markup go-grip adds for
+// the look of GitHub, like heading anchors, classes and highlighted code,
+// is not compared.
+
+// specFence opens and closes the examples of the spec
+const specFence = "````````````````````````````````"
+
+// specExample is an example of the spec with its expected html
+type specExample struct {
+	number    int
+	section   string
+	extension string // Extension the example belongs to, empty for the core
+	markdown  string
+	html      string
+}
+
+// readSpecExamples parses the examples of the spec
+func readSpecExamples(t *testing.T) []specExample {
+	t.Helper()
+	f, err := os.Open("testdata/gfm-spec.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var examples []specExample
+	var current *specExample
+	section := ""
+	inHTML := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.ReplaceAll(scanner.Text(), "→", "\t")
+		switch {
+		case current == nil && strings.HasPrefix(line, specFence+" example"):
+			current = &specExample{
+				number:    len(examples) + 1,
+				section:   section,
+				extension: strings.TrimSpace(strings.TrimPrefix(line, specFence+" example")),
+			}
+			inHTML = false
+		case current == nil && strings.HasPrefix(line, "#"):
+			section = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		case current != nil && line == specFence:
+			examples = append(examples, *current)
+			current = nil
+		case current != nil && line == "." && !inHTML:
+			inHTML = true
+		case current != nil && inHTML:
+			current.html += line + "\n"
+		case current != nil:
+			current.markdown += line + "\n"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return examples
+}
+
+// Elements whose surrounding whitespace does not matter
+var specBlockTags = []string{
+	"address", "article", "aside", "blockquote", "body", "dd", "details", "div", "dl", "dt",
+	"figcaption", "figure", "footer", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr",
+	"li", "nav", "ol", "p", "pre", "section", "summary", "table", "tbody", "td", "tfoot",
+	"th", "thead", "tr", "ul",
+}
+
+// normalizeSpecHTML makes html comparable like the normalization of the
+// spec tests: whitespace around block elements is removed, whitespace in
+// text collapsed outside of pre, attributes sorted and text escaped the
+// same way. Classes, heading ids, spans and heading anchors are go-grip's
+// styling and removed.
+func normalizeSpecHTML(s string) string {
+	var out strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	pre := 0
+	skipAnchor := 0
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				out.WriteString("<!error>")
+			}
+			break
+		}
+		token := tokenizer.Token()
+
+		// Heading anchors are skipped with their content
+		if skipAnchor > 0 {
+			switch {
+			case tt == html.StartTagToken && token.Data == "a":
+				skipAnchor++
+			case tt == html.EndTagToken && token.Data == "a":
+				skipAnchor--
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken:
+			text := token.Data
+			if pre == 0 {
+				text = strings.Join(strings.Fields(text), " ")
+				if strings.TrimSpace(token.Data) != "" {
+					if strings.HasPrefix(token.Data, " ") || strings.HasPrefix(token.Data, "\n") || strings.HasPrefix(token.Data, "\t") {
+						text = " " + text
+					}
+					if strings.HasSuffix(token.Data, " ") || strings.HasSuffix(token.Data, "\n") || strings.HasSuffix(token.Data, "\t") {
+						text += " "
+					}
+				}
+			}
+			out.WriteString(html.EscapeString(text))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if token.Data == "span" {
+				continue
+			}
+			if token.Data == "a" && hasAttr(token, "class", "anchor") {
+				skipAnchor = 1
+				continue
+			}
+			if token.Data == "pre" {
+				pre++
+			}
+			out.WriteString("<" + token.Data + specAttrs(token) + ">")
+		case html.EndTagToken:
+			if token.Data == "span" {
+				continue
+			}
+			if token.Data == "pre" {
+				pre--
+			}
+			out.WriteString("</" + token.Data + ">")
+		case html.CommentToken:
+			out.WriteString("<!--" + token.Data + "-->")
+		case html.DoctypeToken:
+			out.WriteString("<!DOCTYPE " + token.Data + ">")
+		}
+	}
+
+	// Whitespace next to block elements is not significant
+	result := out.String()
+	for _, tag := range specBlockTags {
+		for _, t := range []string{"<" + tag, "</" + tag + ">"} {
+			result = strings.ReplaceAll(result, " "+t, t)
+		}
+		result = strings.ReplaceAll(result, "</"+tag+"> ", "</"+tag+">")
+	}
+	for _, tag := range specBlockTags {
+		result = replaceAfterTag(result, tag)
+	}
+	return strings.TrimSpace(result)
+}
+
+// replaceAfterTag removes a space after the start tags of tag, except in
+// preformatted text where it is part of the content
+func replaceAfterTag(s string, tag string) string {
+	if tag == "pre" {
+		return s
+	}
+	var out strings.Builder
+	for {
+		i := strings.Index(s, "<"+tag)
+		if i < 0 {
+			out.WriteString(s)
+			return out.String()
+		}
+		end := strings.IndexByte(s[i:], '>')
+		if end < 0 {
+			out.WriteString(s)
+			return out.String()
+		}
+		end += i + 1
+		// <p> must not match <pre>
+		if next := s[i+1+len(tag)]; next != '>' && next != ' ' {
+			out.WriteString(s[:end])
+			s = s[end:]
+			continue
+		}
+		out.WriteString(s[:end])
+		s = strings.TrimPrefix(s[end:], " ")
+	}
+}
+
+// hasAttr reports whether a token has the attribute with the value
+func hasAttr(token html.Token, key string, value string) bool {
+	for _, attr := range token.Attr {
+		if attr.Key == key && slices.Contains(strings.Fields(attr.Val), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// specAttrs returns the sorted attributes of a token without styling
+func specAttrs(token html.Token) string {
+	heading := len(token.Data) == 2 && token.Data[0] == 'h' && token.Data[1] >= '1' && token.Data[1] <= '6'
+	var attrs []string
+	for _, attr := range token.Attr {
+		if attr.Key == "class" || attr.Key == "style" && token.Data != "th" && token.Data != "td" || attr.Key == "id" && heading {
+			continue
+		}
+		attrs = append(attrs, fmt.Sprintf(` %s="%s"`, attr.Key, html.EscapeString(attr.Val)))
+	}
+	sort.Strings(attrs)
+	return strings.Join(attrs, "")
+}
+
+// Examples where go-grip renders differently than GitHub, by number. An
+// example that starts to match makes the test fail, so the list stays
+// accurate.
+var specDivergences = []int{
+	// Tabs
+	2, 5, 6, 7, 10, 11,
+	// Thematic breaks
+	27, 30, 31,
+	// ATX headings
+	38, 41, 43, 45, 46, 49,
+	// Setext headings
+	51, 52, 54, 56, 60, 61, 62, 63, 64, 65, 68, 69, 71,
+	// Indented code blocks
+	82,
+	// Fenced code blocks
+	91, 94, 96, 97, 98, 101, 102, 103, 107, 108, 109, 113,
+	// HTML blocks
+	118, 120, 121, 122, 125, 126, 127, 128, 131, 132, 133, 134, 135, 136,
+	137, 139, 140, 141, 142, 143, 145, 146, 147, 149, 150, 151, 152, 153,
+	154, 155, 157, 160,
+	// Link reference definitions
+	163, 164, 165, 168, 169, 170, 171, 173, 175, 177, 182, 183, 187,
+	// Tables (extension)
+	200, 201, 202, 203, 205,
+	// Block quotes
+	206, 207, 208, 210, 211, 212, 213, 214, 215, 216, 217, 218, 219, 220,
+	221, 222, 223, 224, 225, 226, 227, 228, 229, 230,
+	// List items
+	231, 232, 234, 235, 237, 238, 240, 241, 242, 244, 245, 248, 249, 251,
+	252, 255, 256, 258, 259, 261, 262, 264, 265, 266, 268, 270, 271, 273,
+	275, 276, 277, 278,
+	// Lists
+	281, 282, 283, 285, 287, 290, 291, 292, 293, 295, 296, 297, 298, 299,
+	300, 301, 304, 305,
+	// Backslash escapes
+	308, 310, 316, 317, 318, 319,
+	// Entity and numeric character references
+	322, 324, 325, 327, 328, 329, 337,
+	// Code spans
+	340, 341, 342, 344, 345, 346, 350, 352, 356, 357, 359,
+	// Emphasis and strong emphasis
+	362, 363, 365, 368, 369, 371, 378, 379, 382, 385, 389, 394, 395, 396,
+	397, 398, 401, 407, 409, 410, 411, 416, 417, 418, 425, 426, 427, 428,
+	434, 435, 436, 438, 439, 440, 441, 452, 456, 464, 468, 473, 474, 475,
+	476, 477, 479, 482, 483, 484, 485, 486, 489, 490,
+	// Links
+	497, 498, 499, 500, 501, 502, 503, 507, 510, 511, 512, 513, 514, 515,
+	516, 519, 526, 527, 528, 529, 532, 533, 534, 540, 541, 542, 544, 545,
+	546, 549, 550, 551, 552, 554, 558, 564, 572, 576,
+	// Images
+	581, 582, 583, 584, 585, 590, 591, 593, 595, 597,
+	// Autolinks
+	610, 611, 614, 616, 617, 618, 619,
+	// Autolinks (extension)
+	627, 629, 630, 631,
+	// Raw HTML
+	638, 639, 640, 641, 643, 651,
+	// Disallowed Raw HTML (extension)
+	652,
+	// Hard line breaks
+	664, 666,
+}
+
+func TestGFMSpec(t *testing.T) {
+	parser := NewParser("light")
+	parser.SetGFM(true)
+
+	for _, example := range readSpecExamples(t) {
+		name := fmt.Sprintf("%d %s", example.number, example.section)
+		t.Run(name, func(t *testing.T) {
+			if example.extension == "disabled" {
+				t.Skip("example of a disabled extension")
+			}
+
+			got := normalizeSpecHTML(string(parser.MdToHTML([]byte(example.markdown))))
+			want := normalizeSpecHTML(example.html)
+			known := slices.Contains(specDivergences, example.number)
+			switch {
+			case got != want && known:
+				t.Skip("known divergence")
+			case got != want:
+				t.Errorf("example %d diverges from the spec\nmarkdown:\n%s\nwant:\n%s\ngot:\n%s", example.number, example.markdown, want, got)
+			case known:
+				t.Errorf("example %d matches the spec now, remove it from specDivergences", example.number)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// activityTracker records when a server last handled a request, so it can
+// exit after being idle for a while
+type activityTracker struct {
+	last   atomic.Int64 // Unix nanoseconds of the last finished request
+	active atomic.Int64 // Number of requests in flight
+}
+
+func newActivityTracker() *activityTracker {
+	a := &activityTracker{}
+	a.last.Store(time.Now().UnixNano())
+	return a
+}
+
+// wrap counts the requests handled by next. Live reload streams stay open
+// as long as a tab is and the endpoints below /_api/ are polled by tools
+// like go-grip list, so neither counts as activity.
+func (a *activityTracker) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/_events") || strings.Contains(r.URL.Path, "/_api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		a.active.Add(1)
+		defer func() {
+			a.last.Store(time.Now().UnixNano())
+			a.active.Add(-1)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// idleFor returns how long no request has been handled
+func (a *activityTracker) idleFor() time.Duration {
+	if a.active.Load() > 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, a.last.Load()))
+}
+
+// watch calls onIdle once no request has been handled for timeout. It
+// returns early when done is closed.
+func (a *activityTracker) watch(timeout time.Duration, done <-chan struct{}, onIdle func()) {
+	interval := min(max(timeout/10, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if a.idleFor() >= timeout {
+				onIdle()
+				return
+			}
+		}
+	}
+}
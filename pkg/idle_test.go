@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestActivityTrackerIgnoresControlRequests(t *testing.T) {
+	tests := []struct {
+		path   string
+		active bool
+	}{
+		{"/README.md", true},
+		{"/api/guide.md", true},
+		{"/_events", false},
+		{"/api/_events", false},
+		{"/_api/health", false},
+		{"/_api/shutdown", false},
+		{"/api/_api/backlinks", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			a := newActivityTracker()
+			a.last.Store(time.Now().Add(-time.Hour).UnixNano())
+			handler := a.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if active := a.idleFor() < time.Minute; active != tt.active {
+				t.Errorf("request to %s counted as activity: %t, want %t", tt.path, active, tt.active)
+			}
+		})
+	}
+}
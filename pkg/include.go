@@ -0,0 +1,359 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth is how deep includes may be nested
+const maxIncludeDepth = 8
+
+var (
+	// Regex for include directives like <!-- include: ../shared/prereqs.md#setup -->
+	includeRegex = regexp.MustCompile(`^\s*<!--\s*include:\s*(.*?)\s*-->\s*$`)
+	// Regex for wiki-style embeds like ![[Page]] or ![[Page#Section]]
+	embedRegex = regexp.MustCompile(`^\s*!\[\[([^\]]+)\]\]\s*$`)
+	// Regex for the start and end of fenced code blocks
+	fenceRegex = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	// Regex for ATX headings, with the optional closing sequence
+	atxHeadingRegex = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	// Regex for region markers in source files like // #region name
+	regionRegex = regexp.MustCompile(`#(end)?region\b[ \t]*([^\s*]*)`)
+	// Regex for the file attribute of a code block
+	fileAttrRegex = regexp.MustCompile(`\bfile=("[^"]*"|'[^']*'|\S+)`)
+	// Regex for the destination of inline links and images
+	linkDestinationRegex = regexp.MustCompile(`(\]\()([^)\s]+)`)
+)
+
+// includer expands the includes of a document and remembers which files
+// were included, so the document can be reloaded when one of them changes
+type includer struct {
+	root  string          // Directory the URL paths are relative to
+	links *wikiIndex      // Pages ![[Page]] embeds are looked up in
+	deps  map[string]bool // URL paths of the included files
+}
+
+// expandIncludes replaces include directives and embeds in the document at
+// currentPath with the included files. It returns the expanded document and
+// the URL paths of all files it includes, also indirectly.
+func expandIncludes(root string, currentPath string, content []byte, links *wikiIndex) ([]byte, []string) {
+	inc := &includer{root: root, links: links, deps: map[string]bool{}}
+	expanded := inc.expand(content, currentPath, []string{path.Clean(currentPath)})
+
+	var deps []string
+	for dep := range inc.deps {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return expanded, deps
+}
+
+// expand expands the includes of one document. stack holds the documents
+// currently being expanded, the innermost last.
+func (inc *includer) expand(content []byte, currentPath string, stack []string) []byte {
+	var out strings.Builder
+	fence := ""   // Opening fence of the current code block
+	skip := false // Whether the body of the code block is replaced
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		// Nothing inside code blocks is expanded, but a block may be
+		// filled with code from a file
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+				info := parseCodeInfo(strings.TrimSpace(strings.SplitN(line, m[1], 2)[1]))
+				if info.file != "" {
+					out.WriteString(inc.includeCode(line, m[1], info, currentPath, stack))
+					skip = true
+					continue
+				}
+			} else if m[1][0] == fence[0] && len(m[1]) >= len(fence) {
+				fence = ""
+				if skip {
+					skip = false
+					continue
+				}
+			}
+		}
+		if skip {
+			continue
+		}
+		if fence != "" {
+			out.WriteString(line)
+			continue
+		}
+
+		if m := includeRegex.FindStringSubmatch(line); m != nil {
+			out.WriteString(inc.include(m[1], currentPath, stack))
+			continue
+		}
+		if m := embedRegex.FindStringSubmatch(line); m != nil {
+			target, _, _ := strings.Cut(m[1], "|")
+			page, section, _ := strings.Cut(target, "#")
+			urlPath, found := inc.links.resolve(page, currentPath)
+			if !found {
+				out.WriteString(includeWarning(target, "page not found"))
+				continue
+			}
+			if section != "" {
+				urlPath += "#" + section
+			}
+			out.WriteString(inc.include(urlPath, currentPath, stack))
+			continue
+		}
+
+		// Relative links of included files point to the included file's directory
+		if len(stack) > 1 {
+			line = rebaseLinks(line, path.Dir(currentPath), path.Dir(stack[0]))
+		}
+		out.WriteString(line)
+	}
+	return []byte(out.String())
+}
+
+// include returns the expanded content of the target of an include, or a
+// warning if it cannot be included
+func (inc *includer) include(target string, currentPath string, stack []string) string {
+	file, section, _ := strings.Cut(target, "#")
+	urlPath, ok := resolveIncludePath(file, currentPath)
+	if !ok {
+		return includeWarning(target, "outside of the served directory")
+	}
+
+	if slices.Contains(stack, urlPath) {
+		return includeWarning(target, "include cycle "+strings.Join(append(stack, urlPath), " → "))
+	}
+	if len(stack) > maxIncludeDepth {
+		return includeWarning(target, fmt.Sprintf("more than %d nested includes", maxIncludeDepth))
+	}
+
+	data, err := inc.readFile(urlPath)
+	if err != nil {
+		return includeWarning(target, "file not found")
+	}
+	data, _ = extractFrontmatter(data)
+
+	if section != "" {
+		var found bool
+		if data, found = selectSection(data, section); !found {
+			return includeWarning(target, "section not found")
+		}
+	}
+
+	expanded := string(inc.expand(data, urlPath, append(stack[:len(stack):len(stack)], urlPath)))
+	if !strings.HasSuffix(expanded, "\n") {
+		expanded += "\n"
+	}
+	return expanded
+}
+
+// includeCode returns a code block with the lines of the source file given
+// in its info string, or a warning if the file cannot be included. The
+// file attribute is rewritten relative to the including document, so the
+// rendered block links to the source file.
+func (inc *includer) includeCode(line string, fence string, info codeBlockInfo, currentPath string, stack []string) string {
+	urlPath, ok := resolveIncludePath(info.file, currentPath)
+	if !ok {
+		return includeWarning(info.file, "outside of the served directory")
+	}
+	data, err := inc.readFile(urlPath)
+	if err != nil {
+		return includeWarning(info.file, "file not found")
+	}
+
+	code := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if info.region != "" {
+		if code, ok = selectRegion(code, info.region); !ok {
+			return includeWarning(info.file, fmt.Sprintf("region %s not found", info.region))
+		}
+	}
+	if info.lines != "" {
+		if code, ok = selectLines(code, info.lines); !ok {
+			return includeWarning(info.file, fmt.Sprintf("invalid line range %s", info.lines))
+		}
+	}
+	code = strings.TrimRight(code, "\n") + "\n"
+
+	// A longer fence keeps fences in the code from closing the block
+	longFence := fence
+	for strings.Contains(code, longFence) {
+		longFence += fence[:1]
+	}
+
+	file := relativeURL(path.Dir(stack[0]), urlPath)
+	if strings.ContainsAny(file, " \t") {
+		file = `"` + file + `"`
+	}
+	line = strings.Replace(line, fence, longFence, 1)
+	line = fileAttrRegex.ReplaceAllLiteralString(line, "file="+file)
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	return line + code + longFence + "\n"
+}
+
+// resolveIncludePath resolves the path of an included file to its URL path
+// below the root. Paths are relative to the including file, absolute ones
+// to the root. Paths climbing out of the root are rejected.
+func resolveIncludePath(file string, currentPath string) (string, bool) {
+	if strings.HasPrefix(file, "/") {
+		return path.Clean(file), true
+	}
+	rel := path.Clean(path.Join(strings.TrimPrefix(path.Dir(currentPath), "/"), file))
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return path.Clean("/" + rel), true
+}
+
+// readFile reads an included file and records it as a dependency. Symbolic
+// links must not lead out of the root.
+func (inc *includer) readFile(urlPath string) ([]byte, error) {
+	// Missing files are dependencies too, creating them reloads the page
+	inc.deps[urlPath] = true
+
+	file := filepath.Join(inc.root, filepath.FromSlash(urlPath))
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(inc.root)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s is outside of %s", resolved, root)
+	}
+	return os.ReadFile(resolved)
+}
+
+// selectLines returns the lines of a range like 10-30, 10- or 10
+func selectLines(code string, lines string) (string, bool) {
+	all := strings.SplitAfter(strings.TrimSuffix(code, "\n"), "\n")
+	from, to, isRange := strings.Cut(lines, "-")
+	start, err := strconv.Atoi(from)
+	if err != nil || start < 1 || start > len(all) {
+		return "", false
+	}
+	end := start
+	if isRange {
+		end = len(all)
+		if to != "" {
+			if end, err = strconv.Atoi(to); err != nil || end < start {
+				return "", false
+			}
+		}
+	}
+	end = min(end, len(all))
+	return strings.Join(all[start-1:end], ""), true
+}
+
+// selectRegion returns the lines between the markers #region name and
+// #endregion, without the markers of nested regions and with the common
+// indentation removed
+func selectRegion(code string, name string) (string, bool) {
+	var region []string
+	depth := 0
+	for _, line := range strings.SplitAfter(code, "\n") {
+		m := regionRegex.FindStringSubmatch(line)
+		switch {
+		case m == nil:
+			if depth > 0 {
+				region = append(region, line)
+			}
+		case depth == 0 && m[1] == "" && m[2] == name:
+			depth = 1
+		case depth > 0 && m[1] == "":
+			depth++
+		case depth > 0:
+			depth--
+			if depth == 0 {
+				return dedent(region), true
+			}
+		}
+	}
+	return "", false
+}
+
+// dedent removes the indentation all non-blank lines have in common
+func dedent(lines []string) string {
+	indent := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent = lineIndent
+			first = false
+			continue
+		}
+		for !strings.HasPrefix(lineIndent, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(strings.TrimPrefix(line, indent))
+	}
+	return out.String()
+}
+
+// selectSection returns the heading matching section, compared by slug,
+// and everything below it up to the next heading of the same or a higher
+// level
+func selectSection(content []byte, section string) ([]byte, bool) {
+	if unescaped, err := url.PathUnescape(section); err == nil {
+		section = unescaped
+	}
+	want := githubSlug(section)
+
+	var out strings.Builder
+	level := 0
+	fence := ""
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if m[1][0] == fence[0] && len(m[1]) >= len(fence) {
+				fence = ""
+			}
+		} else if m := atxHeadingRegex.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil && fence == "" {
+			switch {
+			case level == 0 && githubSlug(m[2]) == want:
+				level = len(m[1])
+			case level > 0 && len(m[1]) <= level:
+				return []byte(out.String()), true
+			}
+		}
+		if level > 0 {
+			out.WriteString(line)
+		}
+	}
+	return []byte(out.String()), level > 0
+}
+
+// rebaseLinks rewrites the link destinations in a line relative to dir so
+// they are relative to baseDir, the directory of the including document
+func rebaseLinks(line string, dir string, baseDir string) string {
+	return linkDestinationRegex.ReplaceAllStringFunc(line, func(match string) string {
+		destination := linkDestinationRegex.FindStringSubmatch(match)[2]
+		if isExternalLink(destination) || strings.HasPrefix(destination, "/") || strings.HasPrefix(destination, "#") {
+			return match
+		}
+		return "](" + relativeURL(baseDir, path.Join(dir, destination))
+	})
+}
+
+// includeWarning renders a failed include as a visible warning
+func includeWarning(target string, reason string) string {
+	return fmt.Sprintf("> [!WARNING]\n> Cannot include `%s`: %s\n\n", target, reason)
+}
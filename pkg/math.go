@@ -0,0 +1,700 @@
+package pkg
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// Math is rendered to MathML on the server, browsers display it natively
+// and pages work offline and in exports without any script.
+
+var (
+	// Letters of TeX commands for greek letters
+	mathGreek = map[string]string{
+		"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+		"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+		"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "omicron": "ο", "pi": "π", "varpi": "ϖ",
+		"rho": "ρ", "varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ",
+		"phi": "ϕ", "varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+		"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+		"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	}
+
+	// Identifiers written as TeX commands
+	mathIdentifiers = map[string]string{
+		"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "varnothing": "∅",
+		"hbar": "ℏ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "wp": "℘",
+		"angle": "∠", "triangle": "△", "top": "⊤", "bot": "⊥", "degree": "°",
+	}
+
+	// Operators, relations, arrows and delimiters written as TeX commands
+	mathOperators = map[string]string{
+		"cdot": "⋅", "times": "×", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆",
+		"circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖", "otimes": "⊗", "odot": "⊙",
+		"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "ll": "≪", "gg": "≫",
+		"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝",
+		"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+		"supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖", "mid": "∣", "parallel": "∥",
+		"perp": "⊥", "forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬",
+		"land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨", "to": "→", "rightarrow": "→",
+		"leftarrow": "←", "gets": "←", "leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+		"Leftrightarrow": "⇔", "implies": "⟹", "impliedby": "⟸", "iff": "⟺", "mapsto": "↦",
+		"longrightarrow": "⟶", "longleftarrow": "⟵", "uparrow": "↑", "downarrow": "↓",
+		"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+		"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+		"{": "{", "}": "}", "|": "‖", "vert": "|", "Vert": "‖", "lvert": "|", "rvert": "|",
+		"colon": ":", "prime": "′", "#": "#", "$": "$", "%": "%", "&": "&", "_": "_",
+	}
+
+	// Large operators with limits above and below
+	mathLargeOperators = map[string]string{
+		"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂",
+		"bigoplus": "⨁", "bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+	}
+
+	// Integrals keep their limits as scripts
+	mathIntegrals = map[string]string{
+		"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+	}
+
+	// Function names set upright, the second group takes limits
+	mathFunctions = map[string]bool{
+		"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+		"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true,
+		"log": true, "ln": true, "lg": true, "exp": true, "det": true, "dim": true, "ker": true,
+		"deg": true, "gcd": true, "arg": true, "hom": true,
+	}
+	mathLimitFunctions = map[string]bool{
+		"lim": true, "max": true, "min": true, "sup": true, "inf": true,
+		"limsup": true, "liminf": true, "Pr": true, "argmax": true, "argmin": true,
+	}
+
+	// Accents placed over or under their argument
+	mathAccents = map[string]string{
+		"hat": "^", "widehat": "^", "bar": "¯", "overline": "‾", "vec": "→", "dot": "˙",
+		"ddot": "¨", "tilde": "~", "widetilde": "~", "check": "ˇ", "breve": "˘",
+		"overrightarrow": "→", "overleftarrow": "←", "overbrace": "⏞",
+	}
+	mathUnderAccents = map[string]string{
+		"underline": "_", "underbrace": "⏟",
+	}
+
+	// Horizontal spaces in em
+	mathSpaces = map[string]string{
+		",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", " ": "0.25em",
+		"quad": "1em", "qquad": "2em", "!": "-0.1667em", "enspace": "0.5em",
+	}
+
+	// Sizes of \big and friends
+	mathBigSizes = map[string]string{
+		"big": "1.2em", "bigl": "1.2em", "bigr": "1.2em", "bigm": "1.2em",
+		"Big": "1.8em", "Bigl": "1.8em", "Bigr": "1.8em", "Bigm": "1.8em",
+		"bigg": "2.4em", "biggl": "2.4em", "biggr": "2.4em", "biggm": "2.4em",
+		"Bigg": "3em", "Biggl": "3em", "Biggr": "3em", "Biggm": "3em",
+	}
+
+	// Delimiters of matrix environments
+	mathMatrixFences = map[string][2]string{
+		"matrix": {"", ""}, "smallmatrix": {"", ""}, "pmatrix": {"(", ")"}, "bmatrix": {"[", "]"},
+		"Bmatrix": {"{", "}"}, "vmatrix": {"|", "|"}, "Vmatrix": {"‖", "‖"},
+	}
+)
+
+// renderMath renders TeX as a MathML element, display math is set as a
+// block. The TeX source is kept as annotation for copying.
+func renderMath(tex string, display bool) string {
+	p := &texParser{tokens: tokenizeTeX(tex)}
+	body := p.parseSequence(nil)
+
+	displayAttr := "inline"
+	class := "math math-inline"
+	if display {
+		displayAttr = "block"
+		class = "math math-display"
+	}
+	return fmt.Sprintf(`<span class="%s"><math display="%s"><semantics>%s<annotation encoding="application/x-tex">%s</annotation></semantics></math></span>`,
+		class, displayAttr, mrow(body), template.HTMLEscapeString(strings.TrimSpace(tex)))
+}
+
+// renderHookMath renders inline math and math blocks
+func renderHookMath(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	var out string
+	switch n := node.(type) {
+	case *ast.Math:
+		out = renderMath(string(n.Literal), false)
+	case *ast.MathBlock:
+		if entering {
+			out = renderMath(string(n.Literal), true)
+		}
+	}
+
+	if _, err := io.WriteString(w, out); err != nil {
+		log.Println("Error:", err)
+	}
+	return ast.SkipChildren, true
+}
+
+// parseInlineMath parses $...$, $`...`$ and $$...$$ with the rules of
+// GitHub: the content must not start or end with a space and a closing
+// dollar must not be followed by a digit, so prices like $5 stay text.
+func parseInlineMath(p *parser.Parser, data []byte, offset int) (int, ast.Node) {
+	data = data[offset:]
+
+	// $`...`$
+	if len(data) > 2 && data[1] == '`' {
+		end := strings.Index(string(data[2:]), "`$")
+		if end < 0 {
+			return 0, nil
+		}
+		return end + 4, &ast.Math{Leaf: ast.Leaf{Literal: data[2 : end+2]}}
+	}
+
+	// $$...$$ inside a paragraph is display math
+	if len(data) > 1 && data[1] == '$' {
+		end := strings.Index(string(data[2:]), "$$")
+		if end <= 0 {
+			return 0, nil
+		}
+		block := &ast.MathBlock{}
+		block.Literal = data[2 : end+2]
+		return end + 4, block
+	}
+
+	if len(data) < 3 || unicode.IsSpace(rune(data[1])) {
+		return 0, nil
+	}
+	for i := 2; i < len(data); i++ {
+		switch {
+		case data[i] == '\\':
+			// Skip escaped characters like \$
+			i++
+		case data[i] == '$' && !unicode.IsSpace(rune(data[i-1])) && (i+1 == len(data) || !isDigit(data[i+1])):
+			return i + 1, &ast.Math{Leaf: ast.Leaf{Literal: data[1:i]}}
+		}
+	}
+	return 0, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// tokenizeTeX splits TeX into commands, single characters, numbers and
+// runs of whitespace, which only matter in text arguments.
+func tokenizeTeX(tex string) []string {
+	var tokens []string
+	runes := []rune(tex)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			j := i + 1
+			for j < len(runes) && unicode.IsLetter(runes[j]) && runes[j] < unicode.MaxASCII {
+				j++
+			}
+			if j == i+1 {
+				// Control symbols like \, or \{
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j - 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' && j+1 < len(runes) && unicode.IsDigit(runes[j+1])) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j - 1
+		case unicode.IsSpace(r):
+			if len(tokens) == 0 || tokens[len(tokens)-1] != " " {
+				tokens = append(tokens, " ")
+			}
+		default:
+			tokens = append(tokens, string(r))
+		}
+	}
+	return tokens
+}
+
+// texParser converts a TeX token stream into MathML
+type texParser struct {
+	tokens  []string
+	pos     int
+	variant func(r rune) rune // Letter style of \mathbf and friends
+	text    string            // Text argument of \text and \mathrm, raw
+}
+
+// peek returns the next token, math mode ignores whitespace
+func (p *texParser) peek() string {
+	for p.pos < len(p.tokens) && p.tokens[p.pos] == " " {
+		p.pos++
+	}
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *texParser) next() string {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+// parseSequence parses atoms until the end or one of the stop tokens,
+// which is not consumed
+func (p *texParser) parseSequence(stop map[string]bool) []string {
+	var items []string
+	for {
+		tok := p.peek()
+		if tok == "" || stop[tok] {
+			break
+		}
+		if tok == "}" {
+			// Unbalanced closing brace
+			p.next()
+			continue
+		}
+		items = append(items, p.parseScripts(p.parseAtom()))
+	}
+	return items
+}
+
+// parseScripts attaches sub- and superscripts and primes to base
+func (p *texParser) parseScripts(base atom) string {
+	var sub, sup string
+	primes := ""
+	for {
+		switch p.peek() {
+		case "_":
+			p.next()
+			sub = p.parseArgument()
+			continue
+		case "^":
+			p.next()
+			sup = p.parseArgument()
+			continue
+		case "'":
+			p.next()
+			primes += "′"
+			continue
+		}
+		break
+	}
+	if primes != "" {
+		if sup != "" {
+			sup = mrow([]string{"<mo>" + primes + "</mo>", sup})
+		} else {
+			sup = "<mo>" + primes + "</mo>"
+		}
+	}
+
+	switch {
+	case sub == "" && sup == "":
+		return base.markup
+	case base.limits && sup == "":
+		return fmt.Sprintf("<munder>%s%s</munder>", base.markup, sub)
+	case base.limits && sub == "":
+		return fmt.Sprintf("<mover>%s%s</mover>", base.markup, sup)
+	case base.limits:
+		return fmt.Sprintf("<munderover>%s%s%s</munderover>", base.markup, sub, sup)
+	case sup == "":
+		return fmt.Sprintf("<msub>%s%s</msub>", base.markup, sub)
+	case sub == "":
+		return fmt.Sprintf("<msup>%s%s</msup>", base.markup, sup)
+	default:
+		return fmt.Sprintf("<msubsup>%s%s%s</msubsup>", base.markup, sub, sup)
+	}
+}
+
+// parseArgument parses a single atom or a group as argument of a command
+func (p *texParser) parseArgument() string {
+	if p.peek() == "{" {
+		return p.parseGroup()
+	}
+	if p.pos >= len(p.tokens) {
+		return "<mrow></mrow>"
+	}
+	return p.parseAtom().markup
+}
+
+// parseGroup parses {...} into a single row
+func (p *texParser) parseGroup() string {
+	p.next()
+	items := p.parseSequence(map[string]bool{"}": true})
+	p.next()
+	return mrow(items)
+}
+
+// rawArgument returns the source of a {...} argument for text commands
+func (p *texParser) rawArgument() string {
+	if p.peek() != "{" {
+		return p.next()
+	}
+	p.next()
+	var sb strings.Builder
+	depth := 0
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+		if tok == "{" {
+			depth++
+		} else if tok == "}" {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		// Control symbols in text are the character itself, like \_ or \%
+		if len(tok) == 2 && tok[0] == '\\' && !unicode.IsLetter(rune(tok[1])) {
+			tok = tok[1:]
+		}
+		sb.WriteString(tok)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// atom is the MathML of a single item, limits is set for operators that
+// take their scripts above and below
+type atom struct {
+	markup string
+	limits bool
+}
+
+func (p *texParser) parseAtom() atom {
+	tok := p.next()
+	escape := template.HTMLEscapeString
+
+	if tok == "{" {
+		p.pos--
+		return atom{markup: p.parseGroup()}
+	}
+	if !strings.HasPrefix(tok, "\\") || len(tok) == 1 {
+		return atom{markup: p.symbol(tok)}
+	}
+
+	name := tok[1:]
+	if s, ok := mathGreek[name]; ok {
+		if unicode.IsUpper([]rune(s)[0]) {
+			return atom{markup: `<mi mathvariant="normal">` + s + "</mi>"}
+		}
+		return atom{markup: "<mi>" + s + "</mi>"}
+	}
+	if s, ok := mathIdentifiers[name]; ok {
+		return atom{markup: `<mi mathvariant="normal">` + s + "</mi>"}
+	}
+	if s, ok := mathOperators[name]; ok {
+		return atom{markup: "<mo>" + escape(s) + "</mo>"}
+	}
+	if s, ok := mathLargeOperators[name]; ok {
+		return atom{markup: `<mo largeop="true" movablelimits="true">` + s + "</mo>", limits: true}
+	}
+	if s, ok := mathIntegrals[name]; ok {
+		return atom{markup: `<mo largeop="true">` + s + "</mo>"}
+	}
+	if mathFunctions[name] {
+		return atom{markup: "<mi>" + name + "</mi>"}
+	}
+	if mathLimitFunctions[name] {
+		return atom{markup: `<mo movablelimits="true" form="prefix">` + name + "</mo>", limits: true}
+	}
+	if width, ok := mathSpaces[name]; ok {
+		return atom{markup: `<mspace width="` + width + `"></mspace>`}
+	}
+	if s, ok := mathAccents[name]; ok {
+		stretchy := strings.HasPrefix(name, "wide") || strings.HasPrefix(name, "over")
+		return atom{markup: fmt.Sprintf(`<mover accent="true">%s<mo stretchy="%t">%s</mo></mover>`, p.parseArgument(), stretchy, escape(s)), limits: name == "overbrace"}
+	}
+	if s, ok := mathUnderAccents[name]; ok {
+		return atom{markup: fmt.Sprintf(`<munder accentunder="true">%s<mo stretchy="true">%s</mo></munder>`, p.parseArgument(), escape(s)), limits: name == "underbrace"}
+	}
+	if size, ok := mathBigSizes[name]; ok {
+		return atom{markup: fmt.Sprintf(`<mo minsize="%s" maxsize="%s">%s</mo>`, size, size, escape(p.delimiter()))}
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num := p.parseArgument()
+		den := p.parseArgument()
+		return atom{markup: fmt.Sprintf("<mfrac>%s%s</mfrac>", num, den)}
+	case "binom":
+		n := p.parseArgument()
+		k := p.parseArgument()
+		return atom{markup: fmt.Sprintf(`<mrow><mo>(</mo><mfrac linethickness="0">%s%s</mfrac><mo>)</mo></mrow>`, n, k)}
+	case "sqrt":
+		if p.peek() == "[" {
+			p.next()
+			index := mrow(p.parseSequence(map[string]bool{"]": true}))
+			p.next()
+			return atom{markup: fmt.Sprintf("<mroot>%s%s</mroot>", p.parseArgument(), index)}
+		}
+		return atom{markup: fmt.Sprintf("<msqrt>%s</msqrt>", p.parseArgument())}
+	case "text", "textrm", "textup", "textnormal", "mbox", "hbox":
+		return atom{markup: "<mtext>" + escape(p.rawArgument()) + "</mtext>"}
+	case "textbf":
+		return atom{markup: `<mtext style="font-weight: bold">` + escape(p.rawArgument()) + "</mtext>"}
+	case "textit":
+		return atom{markup: `<mtext style="font-style: italic">` + escape(p.rawArgument()) + "</mtext>"}
+	case "operatorname":
+		// \operatorname* places scripts below and above, like \lim
+		if p.peek() == "*" {
+			p.next()
+			return atom{markup: `<mo movablelimits="true" form="prefix">` + escape(p.rawArgument()) + "</mo>", limits: true}
+		}
+		fallthrough
+	case "mathrm", "mathup":
+		text := p.rawArgument()
+		if len([]rune(text)) == 1 {
+			return atom{markup: `<mi mathvariant="normal">` + escape(text) + "</mi>"}
+		}
+		return atom{markup: "<mi>" + escape(text) + "</mi>"}
+	case "mathbf", "boldsymbol", "bm":
+		return atom{markup: p.styled(mathBold)}
+	case "mathbb":
+		return atom{markup: p.styled(mathDoubleStruck)}
+	case "mathcal", "mathscr":
+		return atom{markup: p.styled(mathScript)}
+	case "mathfrak":
+		return atom{markup: p.styled(mathFraktur)}
+	case "mathit", "mathsf", "mathtt":
+		return atom{markup: p.parseArgument()}
+	case "left":
+		return atom{markup: p.parseFenced()}
+	case "middle":
+		return atom{markup: `<mo stretchy="true">` + escape(p.delimiter()) + "</mo>"}
+	case "begin":
+		return atom{markup: p.parseEnvironment()}
+	case "not":
+		if p.peek() == "=" {
+			p.next()
+			return atom{markup: "<mo>≠</mo>"}
+		}
+		// Negate the following operator with a combining slash
+		markup := p.parseAtom().markup
+		if strings.HasSuffix(markup, "</mo>") {
+			markup = strings.TrimSuffix(markup, "</mo>") + "\u0338</mo>"
+		}
+		return atom{markup: markup}
+	case "\\", "displaystyle", "textstyle", "scriptstyle", "limits", "nolimits", "right", "end":
+		// Line breaks outside of environments and style switches are ignored
+		return atom{}
+	}
+
+	return atom{markup: `<merror><mtext>` + escape(tok) + `</mtext></merror>`}
+}
+
+// symbol converts a single character or number
+func (p *texParser) symbol(tok string) string {
+	escape := template.HTMLEscapeString
+	if tok == "" {
+		// End of the input, like an unclosed group
+		return ""
+	}
+	r := []rune(tok)[0]
+	switch {
+	case unicode.IsDigit(r):
+		if p.variant != nil {
+			return "<mn>" + mapRunes(tok, p.variant) + "</mn>"
+		}
+		return "<mn>" + tok + "</mn>"
+	case unicode.IsLetter(r):
+		if p.variant != nil {
+			return "<mi>" + string(p.variant(r)) + "</mi>"
+		}
+		return "<mi>" + escape(tok) + "</mi>"
+	case tok == "-":
+		return "<mo>−</mo>"
+	case tok == "*":
+		return "<mo>∗</mo>"
+	case tok == "~":
+		return "<mtext> </mtext>"
+	case tok == "&":
+		// Column separator outside of an environment
+		return ""
+	case strings.ContainsRune("()[]|", r):
+		return `<mo stretchy="false">` + tok + "</mo>"
+	}
+	return "<mo>" + escape(tok) + "</mo>"
+}
+
+// styled parses the argument of a letter style command
+func (p *texParser) styled(variant func(rune) rune) string {
+	outer := p.variant
+	p.variant = variant
+	defer func() { p.variant = outer }()
+	return p.parseArgument()
+}
+
+// delimiter returns the delimiter following \left, \right and \big
+func (p *texParser) delimiter() string {
+	tok := p.next()
+	if tok == "." {
+		return ""
+	}
+	if s, ok := mathOperators[strings.TrimPrefix(tok, "\\")]; ok && strings.HasPrefix(tok, "\\") {
+		return s
+	}
+	return tok
+}
+
+// parseFenced parses \left( ... \right) into a row with stretchy fences
+func (p *texParser) parseFenced() string {
+	open := p.delimiter()
+	items := p.parseSequence(map[string]bool{"\\right": true})
+	p.next()
+	closing := p.delimiter()
+
+	fence := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return `<mo fence="true" stretchy="true">` + template.HTMLEscapeString(s) + "</mo>"
+	}
+	return "<mrow>" + fence(open) + strings.Join(items, "") + fence(closing) + "</mrow>"
+}
+
+// parseEnvironment parses matrices, cases and aligned equations
+func (p *texParser) parseEnvironment() string {
+	name := p.rawArgument()
+	if name == "array" || name == "alignat" || name == "alignat*" {
+		// Column specification
+		p.rawArgument()
+	}
+
+	stop := map[string]bool{"&": true, "\\\\": true, "\\end": true}
+	var rows [][]string
+	row := []string{}
+	for p.peek() != "" {
+		row = append(row, mrow(p.parseSequence(stop)))
+		switch p.next() {
+		case "&":
+			continue
+		case "\\\\":
+			rows = append(rows, row)
+			row = []string{}
+			continue
+		}
+		// \end{name}
+		p.rawArgument()
+		break
+	}
+	if len(row) > 1 || len(row) == 1 && row[0] != "<mrow></mrow>" {
+		rows = append(rows, row)
+	}
+
+	attrs := ""
+	switch strings.TrimSuffix(name, "*") {
+	case "aligned", "align", "split", "eqnarray", "alignat", "alignedat":
+		attrs = ` columnalign="right left right left right left" columnspacing="0em 1em"`
+	case "cases", "array":
+		attrs = ` columnalign="left left"`
+	case "gathered", "gather":
+		attrs = ` columnalign="center"`
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<mtable" + attrs + ">")
+	for _, cells := range rows {
+		sb.WriteString("<mtr>")
+		for _, cell := range cells {
+			sb.WriteString("<mtd>" + cell + "</mtd>")
+		}
+		sb.WriteString("</mtr>")
+	}
+	sb.WriteString("</mtable>")
+	table := sb.String()
+
+	if name == "cases" {
+		return `<mrow><mo fence="true" stretchy="true">{</mo>` + table + "</mrow>"
+	}
+	if fences, ok := mathMatrixFences[name]; ok && fences[0] != "" {
+		return `<mrow><mo fence="true" stretchy="true">` + fences[0] + "</mo>" + table +
+			`<mo fence="true" stretchy="true">` + fences[1] + "</mo></mrow>"
+	}
+	return table
+}
+
+// mrow wraps several items into a row
+func mrow(items []string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return "<mrow>" + strings.Join(items, "") + "</mrow>"
+}
+
+func mapRunes(s string, f func(rune) rune) string {
+	var sb strings.Builder
+	for _, r := range s {
+		sb.WriteRune(f(r))
+	}
+	return sb.String()
+}
+
+// Letter styles map to the Mathematical Alphanumeric Symbols block, some
+// letters live in Letterlike Symbols instead
+
+func mathBold(r rune) rune {
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return 0x1D400 + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return 0x1D41A + r - 'a'
+	case r >= '0' && r <= '9':
+		return 0x1D7CE + r - '0'
+	}
+	return r
+}
+
+func mathDoubleStruck(r rune) rune {
+	exceptions := map[rune]rune{'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'}
+	if s, ok := exceptions[r]; ok {
+		return s
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return 0x1D538 + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return 0x1D552 + r - 'a'
+	case r >= '0' && r <= '9':
+		return 0x1D7D8 + r - '0'
+	}
+	return r
+}
+
+func mathScript(r rune) rune {
+	exceptions := map[rune]rune{'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+		'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'}
+	if s, ok := exceptions[r]; ok {
+		return s
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return 0x1D49C + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return 0x1D4B6 + r - 'a'
+	}
+	return r
+}
+
+func mathFraktur(r rune) rune {
+	exceptions := map[rune]rune{'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'}
+	if s, ok := exceptions[r]; ok {
+		return s
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return 0x1D504 + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return 0x1D51E + r - 'a'
+	}
+	return r
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMathDegenerateInput(t *testing.T) {
+	tests := []struct {
+		name string
+		tex  string
+	}{
+		{"empty", ""},
+		{"whitespace", " \n "},
+		{"unclosed group", `\frac{`},
+		{"unclosed group with whitespace", "\\frac{\n"},
+		{"open brace", "{"},
+		{"close brace", "}"},
+		{"missing superscript", "x^"},
+		{"missing subscript", "x_ "},
+		{"missing fraction arguments", `\frac`},
+		{"unclosed root index", `\sqrt[`},
+		{"unclosed left", `\left(`},
+		{"left without delimiter", `\left`},
+		{"unclosed environment", `\begin{matrix} a &`},
+		{"environment without name", `\begin`},
+		{"unclosed text", `\text{a`},
+		{"negation at the end", `\not`},
+		{"big without delimiter", `\big`},
+		{"lone backslash", `\`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, display := range []bool{false, true} {
+				out := renderMath(tt.tex, display)
+				if !strings.Contains(out, "<math") || !strings.HasSuffix(out, "</math></span>") {
+					t.Errorf("renderMath(%q, %t) = %q, want a math element", tt.tex, display, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMathBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"empty display math", "$$\n$$\n", `<math display="block">`},
+		{"empty math block", "```math\n```\n", `<math display="block">`},
+		{"unclosed group in math block", "```math\n\\frac{\n```\n", "<mfrac>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := string(NewParser("light").MdToHTML([]byte(tt.markdown)))
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("MdToHTML(%q) = %q, want it to contain %q", tt.markdown, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMathOperatorName(t *testing.T) {
+	tests := []struct {
+		tex  string
+		want string
+	}{
+		{`\operatorname*{argmax}_x f`, `<munder><mo movablelimits="true" form="prefix">argmax</mo><mi>x</mi></munder>`},
+		{`\operatorname{sgn} x`, `<mi>sgn</mi>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tex, func(t *testing.T) {
+			out := renderMath(tt.tex, true)
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("renderMath(%q) = %q, want it to contain %q", tt.tex, out, tt.want)
+			}
+			if strings.Contains(out, "<mo>*</mo>") {
+				t.Errorf("renderMath(%q) = %q, renders the star", tt.tex, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// navigation holds the sidebar tree, the breadcrumbs and the links to the
+// previous and next page shown around the content of a page
+type navigation struct {
+	Tree        []*navItem
+	Breadcrumbs []navLink // The last entry is the current page and has no link
+	Prev        *navLink
+	Next        *navLink
+}
+
+// navLink is a titled link to a page or directory
+type navLink struct {
+	Title string
+	Href  string
+}
+
+// navItem is a file or directory in the sidebar tree
+type navItem struct {
+	navLink
+	Dir      bool
+	Active   bool // True for the page currently shown
+	Open     bool // True for directories containing the current page
+	Children []*navItem
+}
+
+// buildNavigation creates the navigation for the page at current, an URL
+// path relative to the root of toc. Directory pages end with a slash. The
+// href function turns URL paths into the links used in the page.
+func buildNavigation(toc *DirectoryTOC, current string, href func(urlPath string) string) *navigation {
+	nav := &navigation{}
+	root := &navItem{Dir: true}
+	dirs := map[string]*navItem{"/": root}
+
+	// dirItem returns the sidebar entry of a directory, creating its parents
+	var dirItem func(dir string) *navItem
+	dirItem = func(dir string) *navItem {
+		if item, ok := dirs[dir]; ok {
+			return item
+		}
+		parent := dirItem(path.Dir(dir))
+		item := &navItem{
+			navLink: navLink{Title: path.Base(dir), Href: href(dir + "/")},
+			Dir:     true,
+			Active:  current == dir+"/",
+			Open:    strings.HasPrefix(current, dir+"/"),
+		}
+		parent.Children = append(parent.Children, item)
+		dirs[dir] = item
+		return item
+	}
+
+	// Drafts and hidden files are only shown while they are open
+	var files []MarkdownFile
+	for _, file := range toc.Files {
+		if !file.Hidden || "/"+filepath.ToSlash(file.Path) == current {
+			files = append(files, file)
+		}
+	}
+
+	// Files keep the order of ScanMarkdownFiles, which is also the reading
+	// order for the previous and next links
+	for i, file := range files {
+		urlPath := "/" + filepath.ToSlash(file.Path)
+		item := &navItem{
+			navLink: navLink{Title: file.Title, Href: href(urlPath)},
+			Active:  urlPath == current,
+		}
+		parent := dirItem(path.Dir(urlPath))
+		parent.Children = append(parent.Children, item)
+
+		if !item.Active {
+			continue
+		}
+		if i > 0 {
+			prev := files[i-1]
+			nav.Prev = &navLink{Title: prev.Title, Href: href("/" + filepath.ToSlash(prev.Path))}
+		}
+		if i < len(files)-1 {
+			next := files[i+1]
+			nav.Next = &navLink{Title: next.Title, Href: href("/" + filepath.ToSlash(next.Path))}
+		}
+	}
+	nav.Tree = root.Children
+
+	// Breadcrumbs follow the URL path, directories link to their listing
+	nav.Breadcrumbs = []navLink{{Title: "Home", Href: href("/")}}
+	if current == "/" {
+		nav.Breadcrumbs[0].Href = ""
+		return nav
+	}
+	segments := strings.Split(strings.Trim(current, "/"), "/")
+	for i, segment := range segments {
+		if i == len(segments)-1 {
+			if markdownRegex.MatchString(segment) {
+				segment = strings.TrimSuffix(segment, path.Ext(segment))
+			}
+			nav.Breadcrumbs = append(nav.Breadcrumbs, navLink{Title: segment})
+			break
+		}
+		dir := "/" + strings.Join(segments[:i+1], "/") + "/"
+		nav.Breadcrumbs = append(nav.Breadcrumbs, navLink{Title: segment, Href: href(dir)})
+	}
+
+	return nav
+}
+
+// escapePath escapes an URL path for use in a link
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
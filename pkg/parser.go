@@ -9,6 +9,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/alecthomas/chroma/v2"
 	chroma_html "github.com/alecthomas/chroma/v2/formatters/html"
@@ -19,13 +20,16 @@ import (
 	"github.com/gomarkdown/markdown/ast"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
-	"gopkg.in/yaml.v3"
 )
 
 var blockquotes = []string{"Note", "Tip", "Important", "Warning", "Caution", "BlockQuote"}
 
 type Parser struct {
-	theme string
+	theme          string
+	gfm            bool   // GFM conformance mode
+	codeStyleLight string // Chroma style of code blocks in light mode
+	codeStyleDark  string // Chroma style of code blocks in dark mode
+	frontmatter    string // How the frontmatter is shown
 }
 
 // Frontmatter holds parsed frontmatter data
@@ -33,137 +37,321 @@ type Frontmatter map[string]interface{}
 
 func NewParser(theme string) *Parser {
 	return &Parser{
-		theme: theme,
+		theme:          theme,
+		codeStyleLight: "github",
+		codeStyleDark:  "github-dark",
+		frontmatter:    FrontmatterTable,
 	}
 }
 
+// SetGFM enables or disables the GFM conformance mode, which adds
+// footnotes, definition lists and www. autolinks like on GitHub
+func (m *Parser) SetGFM(enabled bool) {
+	m.gfm = enabled
+}
+
+// SetCodeStyle selects the Chroma style for syntax highlighting. A single
+// style is used for both modes, "light,dark" selects one per mode.
+func (m *Parser) SetCodeStyle(style string) {
+	light, dark, found := strings.Cut(style, ",")
+	if !found {
+		dark = light
+	}
+	for _, name := range []string{light, dark} {
+		if _, ok := styles.Registry[name]; !ok {
+			log.Println("Warning: Unknown code style ", name, ", keeping the default")
+			return
+		}
+	}
+	m.codeStyleLight = light
+	m.codeStyleDark = dark
+}
+
+// SetFrontmatter selects how the frontmatter is shown above the document:
+// hidden, as table or as collapsible table
+func (m *Parser) SetFrontmatter(display string) {
+	switch display {
+	case FrontmatterHidden, FrontmatterTable, FrontmatterCollapsible:
+		m.frontmatter = display
+	default:
+		log.Println("Warning: Unknown frontmatter display ", display, ", keeping the default")
+	}
+}
+
+// codeStyle returns the Chroma style matching the theme
+func (m Parser) codeStyle() *chroma.Style {
+	if m.theme == "dark" {
+		return styles.Get(m.codeStyleDark)
+	}
+	return styles.Get(m.codeStyleLight)
+}
+
+// Heading is a heading of a rendered document
+type Heading struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// RenderResult is a rendered document with the headings found in it
+type RenderResult struct {
+	HTML        []byte
+	Headings    []Heading // Outline of the page, empty with toc: false
+	Title       string    // Frontmatter title or first H1, empty without both
+	Description string    // Frontmatter description
+	Layout      string    // Frontmatter layout, empty for the default layout
+}
+
 func (m Parser) MdToHTML(content []byte) []byte {
+	return m.Render(content).HTML
+}
+
+// Render renders markdown to html and collects the headings for the outline
+func (m Parser) Render(content []byte) RenderResult {
 	// Extract frontmatter if present
-	cleanContent, frontmatter := extractFrontmatter(content)
-	
+	cleanContent, frontmatter, err := splitFrontmatter(content)
+	if err != nil {
+		log.Println("Warning:", err)
+	}
+
 	// Parse the markdown (without frontmatter)
-	extensions := parser.NoIntraEmphasis | parser.Tables | parser.FencedCode |
-		parser.Autolink | parser.Strikethrough | parser.SpaceHeadings | parser.HeadingIDs |
-		parser.BackslashLineBreak | parser.MathJax | parser.OrderedListStart
-	p := parser.NewWithExtensions(extensions)
-	doc := p.Parse(cleanContent)
+	doc := parseMarkdown(cleanContent, m.gfm)
+	headings := collectHeadings(doc)
+
+	// A [[_TOC_]] or [TOC] paragraph is replaced with the outline
+	hook := func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		if paragraph, ok := node.(*ast.Paragraph); ok && isTOCMarker(paragraph) {
+			if entering {
+				_, err := io.WriteString(w, renderOutline(headings))
+				if err != nil {
+					log.Println("Error:", err)
+				}
+			}
+			return ast.SkipChildren, true
+		}
+		return m.renderHook(w, node, entering)
+	}
 
 	htmlFlags := html.CommonFlags
-	opts := html.RendererOptions{Flags: htmlFlags, RenderNodeHook: m.renderHook}
+	opts := html.RendererOptions{Flags: htmlFlags, RenderNodeHook: hook}
 	renderer := html.NewRenderer(opts)
 
 	renderedMarkdown := markdown.Render(doc, renderer)
-	
+
 	// If we have frontmatter, render it and prepend to the content
 	if frontmatter != nil {
-		frontmatterHTML := renderFrontmatter(frontmatter)
-		return append(frontmatterHTML, renderedMarkdown...)
+		frontmatterHTML := renderFrontmatter(frontmatter, m.frontmatter)
+		renderedMarkdown = append(frontmatterHTML, renderedMarkdown...)
+	}
+
+	// Invalid frontmatter is shown instead of silently dropped
+	if err != nil {
+		renderedMarkdown = append(frontmatterError(err), renderedMarkdown...)
+	}
+
+	meta := frontmatterMeta(frontmatter)
+	result := RenderResult{
+		HTML:        renderedMarkdown,
+		Title:       documentTitle(frontmatter, headings),
+		Description: meta.Description,
+		Layout:      pageLayout(meta),
+	}
+	if meta.Outline {
+		result.Headings = headings
 	}
-	
-	return renderedMarkdown
+	return result
 }
 
-// extractFrontmatter extracts YAML frontmatter from markdown content
-func extractFrontmatter(content []byte) ([]byte, Frontmatter) {
-	contentStr := string(content)
-	
-	// Check if content starts with ---
-	if !strings.HasPrefix(contentStr, "---\n") && !strings.HasPrefix(contentStr, "---\r\n") {
-		return content, nil
-	}
-	
-	// Find the closing ---
-	lines := strings.Split(contentStr, "\n")
-	endIndex := -1
-	for i := 1; i < len(lines); i++ {
-		if strings.TrimSpace(lines[i]) == "---" {
-			endIndex = i
-			break
+// documentTitle returns the frontmatter title, else the text of the first H1
+func documentTitle(frontmatter Frontmatter, headings []Heading) string {
+	if title, ok := frontmatter["title"].(string); ok && strings.TrimSpace(title) != "" {
+		return strings.TrimSpace(title)
+	}
+	for _, heading := range headings {
+		if heading.Level == 1 {
+			return heading.Text
 		}
 	}
-	
-	// If no closing ---, return original content
-	if endIndex == -1 {
-		return content, nil
-	}
-	
-	// Extract frontmatter content
-	frontmatterLines := lines[1:endIndex]
-	frontmatterContent := strings.Join(frontmatterLines, "\n")
-	
-	// Parse YAML
-	var frontmatter Frontmatter
-	err := yaml.Unmarshal([]byte(frontmatterContent), &frontmatter)
-	if err != nil {
-		// If parsing fails, return original content
-		log.Printf("Failed to parse frontmatter: %v", err)
-		return content, nil
-	}
-	
-	// Return content without frontmatter
-	remainingLines := lines[endIndex+1:]
-	cleanContent := strings.Join(remainingLines, "\n")
-	
-	return []byte(cleanContent), frontmatter
+	return ""
 }
 
-// renderFrontmatter renders frontmatter as an HTML table
-func renderFrontmatter(frontmatter Frontmatter) []byte {
-	if len(frontmatter) == 0 {
-		return nil
-	}
-	
-	var buf bytes.Buffer
-	
-	// Create a styled info box for frontmatter
-	buf.WriteString(`<div class="frontmatter-box" style="background-color: #f6f8fa; border: 1px solid #d1d5da; border-radius: 6px; padding: 16px; margin-bottom: 16px; font-size: 14px;">`)
-	buf.WriteString(`<h4 style="margin-top: 0; margin-bottom: 12px; color: #24292e;">Document Information</h4>`)
-	buf.WriteString(`<table style="width: 100%; border-collapse: collapse;">`)
-	
-	for key, value := range frontmatter {
-		buf.WriteString(`<tr>`)
-		buf.WriteString(fmt.Sprintf(`<td style="padding: 4px 8px; font-weight: 600; color: #586069; vertical-align: top; width: 150px;">%s:</td>`, template.HTMLEscapeString(key)))
-		
-		// Format the value based on its type
-		var valueStr string
-		switch v := value.(type) {
-		case []interface{}:
-			// Handle arrays (like tags)
-			var items []string
-			for _, item := range v {
-				items = append(items, fmt.Sprintf("%v", item))
-			}
-			valueStr = strings.Join(items, ", ")
-		case map[string]interface{}:
-			// Handle nested objects
-			var items []string
-			for k, val := range v {
-				items = append(items, fmt.Sprintf("%s: %v", k, val))
-			}
-			valueStr = strings.Join(items, ", ")
-		case map[interface{}]interface{}:
-			// Handle nested objects (alternative format from YAML)
-			var items []string
-			for k, val := range v {
-				items = append(items, fmt.Sprintf("%v: %v", k, val))
-			}
-			valueStr = strings.Join(items, ", ")
+// collectHeadings returns the headings of a document in order
+func collectHeadings(doc ast.Node) []Heading {
+	var headings []Heading
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.HeadingID == "" {
+			return ast.GoToNext
+		}
+		headings = append(headings, Heading{
+			Level: heading.Level,
+			ID:    heading.HeadingID,
+			Text:  plainText(heading),
+		})
+		return ast.SkipChildren
+	})
+	return headings
+}
+
+// plainText returns the text of a node without any markup
+func plainText(node ast.Node) string {
+	var sb strings.Builder
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if _, ok := n.(*ast.HTMLSpan); ok {
+			return ast.GoToNext
+		}
+		if leaf := n.AsLeaf(); leaf != nil && entering {
+			sb.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// isTOCMarker reports whether a paragraph only consists of [[_TOC_]] or
+// [TOC]. The underscores of [[_TOC_]] are parsed as emphasis.
+func isTOCMarker(paragraph *ast.Paragraph) bool {
+	var sb strings.Builder
+	for _, child := range paragraph.GetChildren() {
+		switch c := child.(type) {
+		case *ast.Text:
+			sb.Write(c.Literal)
+		case *ast.Emph:
+			sb.WriteString("_" + plainText(c) + "_")
 		default:
-			valueStr = fmt.Sprintf("%v", v)
+			return false
 		}
-		
-		buf.WriteString(fmt.Sprintf(`<td style="padding: 4px 8px; color: #24292e;">%s</td>`, template.HTMLEscapeString(valueStr)))
-		buf.WriteString(`</tr>`)
-	}
-	
-	buf.WriteString(`</table>`)
-	buf.WriteString(`</div>`)
-	
-	return buf.Bytes()
+	}
+	marker := strings.TrimSpace(sb.String())
+	return marker == "[[_TOC_]]" || marker == "[TOC]"
+}
+
+// renderOutline renders headings as nested lists linking to the headings
+func renderOutline(headings []Heading) string {
+	if len(headings) == 0 {
+		return ""
+	}
+
+	// Nesting is relative to the highest heading level of the document
+	base := headings[0].Level
+	for _, h := range headings {
+		base = min(base, h.Level)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<nav class="toc">`)
+	depth := 0
+	for _, h := range headings {
+		// Skipped levels only nest one list deeper
+		level := min(h.Level-base+1, depth+1)
+		if level > depth {
+			sb.WriteString("<ul>")
+			depth = level
+		} else {
+			sb.WriteString("</li>")
+			for ; depth > level; depth-- {
+				sb.WriteString("</ul></li>")
+			}
+		}
+		sb.WriteString(fmt.Sprintf(`<li><a href="#%s">%s</a>`, template.HTMLEscapeString(h.ID), template.HTMLEscapeString(h.Text)))
+	}
+	for ; depth > 0; depth-- {
+		sb.WriteString("</li></ul>")
+	}
+	sb.WriteString(`</nav>`)
+	return sb.String()
+}
+
+// parseMarkdown parses markdown into an AST with the extensions used for
+// rendering, gfm adds the extensions of the GFM conformance mode
+func parseMarkdown(content []byte, gfm bool) ast.Node {
+	extensions := parser.NoIntraEmphasis | parser.Tables | parser.FencedCode |
+		parser.Autolink | parser.Strikethrough | parser.SpaceHeadings | parser.HeadingIDs |
+		parser.BackslashLineBreak | parser.MathJax | parser.OrderedListStart
+	if gfm {
+		extensions |= gfmExtensions
+	}
+	p := parser.NewWithExtensions(extensions)
+	p.RegisterInline('$', parseInlineMath)
+	doc := p.Parse(content)
+	if gfm {
+		autolinkWWW(doc)
+	}
+	assignHeadingIDs(doc)
+	return doc
+}
+
+// assignHeadingIDs gives every heading without an explicit {#id} the slug
+// GitHub would generate, so links written for GitHub work in the preview
+func assignHeadingIDs(doc ast.Node) {
+	occurrences := map[string]int{}
+
+	// Explicit ids are taken first
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if heading, ok := node.(*ast.Heading); ok && entering && heading.HeadingID != "" {
+			occurrences[heading.HeadingID] = 0
+		}
+		return ast.GoToNext
+	})
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.HeadingID != "" {
+			return ast.GoToNext
+		}
+		heading.HeadingID = uniqueSlug(githubSlug(plainText(heading)), occurrences)
+		return ast.SkipChildren
+	})
+}
+
+// Regex for emoji shortcodes like :+1:
+var emojiCodeRegex = regexp.MustCompile(`:\S+?:`)
+
+// githubSlug turns heading text into an id like GitHub does: lowercase,
+// punctuation and emojis removed and spaces replaced with hyphens
+func githubSlug(text string) string {
+	// Emojis are rendered as images or symbols, neither is part of the slug
+	text = emojiCodeRegex.ReplaceAllStringFunc(text, func(code string) string {
+		if _, ok := EmojiMap[code]; ok {
+			return ""
+		}
+		return code
+	})
+
+	var sb strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == ' ':
+			sb.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r):
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// uniqueSlug appends -1, -2, ... to slugs that were used before
+func uniqueSlug(slug string, occurrences map[string]int) string {
+	result := slug
+	for {
+		if _, taken := occurrences[result]; !taken {
+			break
+		}
+		occurrences[slug]++
+		result = fmt.Sprintf("%s-%d", slug, occurrences[slug])
+	}
+	occurrences[result] = 0
+	return result
 }
 
 func (m Parser) renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	if status, handled := renderHookFootnote(w, node, entering); handled {
+		return status, true
+	}
+
 	switch node.(type) {
+	case *ast.Heading:
+		return renderHookHeading(w, node, entering)
 	case *ast.BlockQuote:
 		return renderHookBlockQuote()
 	case *ast.Paragraph:
@@ -173,16 +361,20 @@ func (m Parser) renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkS
 	case *ast.ListItem:
 		return renderHookListItem(w, node, entering)
 	case *ast.CodeBlock:
-		return renderHookCodeBlock(w, node, m.theme)
+		return renderHookCodeBlock(w, node, m.theme, m.codeStyle())
+	case *ast.Math, *ast.MathBlock:
+		return renderHookMath(w, node, entering)
 	}
 
 	return ast.GoToNext, false
 }
 
-func renderHookCodeBlock(w io.Writer, node ast.Node, theme string) (ast.WalkStatus, bool) {
+func renderHookCodeBlock(w io.Writer, node ast.Node, theme string, style *chroma.Style) (ast.WalkStatus, bool) {
 	block := node.(*ast.CodeBlock)
 
-	if string(block.Info) == "mermaid" {
+	info := parseCodeInfo(string(block.Info))
+
+	if info.lang == "mermaid" {
 		m, err := renderMermaid(string(block.Literal), theme)
 		if err != nil {
 			log.Println("Error:", err)
@@ -191,11 +383,21 @@ func renderHookCodeBlock(w io.Writer, node ast.Node, theme string) (ast.WalkStat
 		return ast.GoToNext, true
 	}
 
+	// GitHub's ```math blocks are display math
+	if info.lang == "math" {
+		fmt.Fprint(w, renderMath(string(block.Literal), true))
+		return ast.GoToNext, true
+	}
+
 	var lexer chroma.Lexer
-	if block.Info == nil {
+	switch {
+	case info.lang != "":
+		lexer = lexers.Get(info.lang)
+	case info.file != "":
+		// Code included from a file is highlighted by its extension
+		lexer = lexers.Match(path.Base(info.file))
+	default:
 		lexer = lexers.Analyse(string(block.Literal))
-	} else {
-		lexer = lexers.Get(string(block.Info))
 	}
 	// ensure lexer is never nil
 	if lexer == nil {
@@ -203,8 +405,43 @@ func renderHookCodeBlock(w io.Writer, node ast.Node, theme string) (ast.WalkStat
 	}
 
 	iterator, _ := lexer.Tokenise(nil, string(block.Literal))
-	formatter := chroma_html.New(chroma_html.WithClasses(true))
-	err := formatter.Format(w, styles.Fallback, iterator)
+
+	// Blocks without attributes are rendered as plain highlighted code
+	if !info.hasOptions() {
+		formatter := chroma_html.New(chroma_html.WithClasses(true))
+		err := formatter.Format(w, style, iterator)
+		if err != nil {
+			log.Println("Error:", err)
+		}
+		return ast.GoToNext, true
+	}
+
+	formatter := chroma_html.New(info.formatterOptions(string(block.Literal))...)
+	fmt.Fprint(w, `<div class="code-block">`)
+	if info.title != "" || info.file != "" {
+		fmt.Fprint(w, info.titleHTML())
+	}
+	err := formatter.Format(w, style, iterator)
+	if err != nil {
+		log.Println("Error:", err)
+	}
+	fmt.Fprint(w, "</div>")
+	return ast.GoToNext, true
+}
+
+// renderHookHeading renders headings with an anchor link shown on hover
+func renderHookHeading(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	heading := node.(*ast.Heading)
+
+	var err error
+	if !entering {
+		_, err = fmt.Fprintf(w, "</h%d>\n", heading.Level)
+	} else if heading.HeadingID == "" {
+		_, err = fmt.Fprintf(w, "<h%d>", heading.Level)
+	} else {
+		id := template.HTMLEscapeString(heading.HeadingID)
+		_, err = fmt.Fprintf(w, `<h%d id="%s"><a class="anchor" aria-hidden="true" href="#%s"><span class="octicon octicon-link"></span></a>`, heading.Level, id, id)
+	}
 	if err != nil {
 		log.Println("Error:", err)
 	}
@@ -331,8 +568,12 @@ func renderHookText(w io.Writer, node ast.Node) (ast.WalkStatus, bool) {
 func renderHookListItem(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
 	block := node.(*ast.ListItem)
 
+	// Empty list items have no paragraph, empty paragraphs no text
+	if len(block.GetChildren()) == 0 {
+		return ast.GoToNext, false
+	}
 	paragraph, ok := (block.GetChildren()[0]).(*ast.Paragraph)
-	if !ok {
+	if !ok || len(paragraph.GetChildren()) == 0 {
 		return ast.GoToNext, false
 	}
 
@@ -0,0 +1,293 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tokenHeader carries the per-instance secret that authorizes control
+// requests such as shutdown. It keeps web pages from stopping servers.
+const tokenHeader = "X-Grip-Token"
+
+// appName identifies go-grip servers on the health endpoint
+const appName = "go-grip"
+
+// Identity is what a running instance reports on its health endpoint
+type Identity struct {
+	App       string  `json:"app"`
+	PID       int     `json:"pid"`
+	Directory string  `json:"directory,omitempty"`
+	Mounts    []Mount `json:"mounts,omitempty"`
+}
+
+// Instance describes a running go-grip server in the instance registry
+type Instance struct {
+	PID         int       `json:"pid"`
+	Host        string    `json:"host"`
+	Port        int       `json:"port"`
+	Directory   string    `json:"directory,omitempty"`
+	Mounts      []Mount   `json:"mounts,omitempty"`
+	InitialFile string    `json:"initialFile,omitempty"`
+	StartTime   time.Time `json:"startTime"`
+	Token       string    `json:"token,omitempty"`
+
+	file string // registry file the entry was read from
+}
+
+// URL returns the base URL of the instance
+func (i Instance) URL() string {
+	return fmt.Sprintf("http://%s:%d/", i.Host, i.Port)
+}
+
+// BaseURL returns the URL under which the instance serves the given
+// absolute directory, either at its root or below a mount prefix.
+func (i Instance) BaseURL(directory string) (string, bool) {
+	prefix, ok := servedPrefix(i.Directory, i.Mounts, directory)
+	if !ok {
+		return "", false
+	}
+	return i.URL() + prefix, true
+}
+
+// servedPrefix returns the URL prefix, including a trailing slash, at which
+// a server with the given root directory or mounts serves directory.
+func servedPrefix(root string, mounts []Mount, directory string) (string, bool) {
+	if root != "" && root == directory {
+		return "", true
+	}
+	for _, m := range mounts {
+		if m.Directory == directory {
+			return m.Name + "/", true
+		}
+	}
+	return "", false
+}
+
+// RegistryDir returns the per-user directory holding the instance registry.
+// It lives in $XDG_RUNTIME_DIR when available and in the temp dir otherwise.
+func RegistryDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "go-grip")
+	}
+
+	name := "go-grip"
+	if u, err := user.Current(); err == nil {
+		// Windows usernames may contain a domain prefix
+		name += "-" + strings.ReplaceAll(u.Username, `\`, "_")
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// registerInstance writes the instance to the registry and returns a
+// function that removes it again.
+func registerInstance(inst *Instance) (func(), error) {
+	dir := RegistryDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %w", err)
+	}
+
+	if inst.Token == "" {
+		token, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		inst.Token = token
+	}
+
+	data, err := json.MarshalIndent(inst, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// Write to a temporary file first so readers never see partial entries
+	file := filepath.Join(dir, fmt.Sprintf("%d-%d.json", inst.PID, inst.Port))
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write registry entry: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to write registry entry: %w", err)
+	}
+	inst.file = file
+
+	return func() {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove registry entry: %v", err)
+		}
+	}, nil
+}
+
+// ListInstances returns all running instances sorted by start time.
+// Entries of processes that are no longer alive are removed.
+func ListInstances() ([]Instance, error) {
+	dir := RegistryDir()
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	instances := []Instance{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		var inst Instance
+		if err := json.Unmarshal(data, &inst); err != nil || !processAlive(inst.PID) {
+			// Corrupt or stale entry, prune it
+			os.Remove(file)
+			continue
+		}
+		inst.file = file
+		instances = append(instances, inst)
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].StartTime.Before(instances[j].StartTime)
+	})
+
+	return instances, nil
+}
+
+// Stop asks the instance to shut down gracefully. If it refuses, the process
+// is terminated once its health endpoint confirms it is this instance.
+// Otherwise the entry is stale, it is removed and reported as an error.
+func (i Instance) Stop(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.URL()+"_api/shutdown", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(tokenHeader, i.Token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusAccepted {
+			return nil
+		}
+	}
+
+	// Only signal the process if it still is this instance, the PID may
+	// have been reused by an unrelated process since it registered
+	id, err := i.Identify(ctx)
+	if err != nil || id.App != appName || id.PID != i.PID {
+		if i.file != "" {
+			os.Remove(i.file)
+		}
+		return fmt.Errorf("instance on port %d does not answer as go-grip (PID %d), removed its stale registry entry", i.Port, i.PID)
+	}
+
+	if err := terminateProcess(i.PID); err != nil {
+		return fmt.Errorf("failed to stop instance on port %d: %w", i.Port, err)
+	}
+	if i.file != "" {
+		os.Remove(i.file)
+	}
+	return nil
+}
+
+// Identify asks the instance who it is via its health endpoint
+func (i Instance) Identify(ctx context.Context) (*Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.URL()+"_api/health", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	var id Identity
+	if err := json.NewDecoder(resp.Body).Decode(&id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// FindInstance returns a running instance that serves the given absolute
+// directory, or nil if there is none. Registry entries are confirmed with
+// the health endpoint so a reused pid or port is never mistaken for a server.
+func FindInstance(directory string) (*Instance, error) {
+	instances, err := ListInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inst := range instances {
+		prefix, ok := servedPrefix(inst.Directory, inst.Mounts, directory)
+		if !ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		id, err := inst.Identify(ctx)
+		cancel()
+		if err != nil {
+			continue
+		}
+		if id.App != appName || id.PID != inst.PID {
+			continue
+		}
+		if idPrefix, ok := servedPrefix(id.Directory, id.Mounts, directory); ok && idPrefix == prefix {
+			return &inst, nil
+		}
+	}
+	return nil, nil
+}
+
+// healthHandler reports the identity of the instance
+func healthHandler(id Identity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(id); err != nil {
+			log.Printf("Error: %v", err)
+		}
+	}
+}
+
+// shutdownHandler returns a handler that calls shutdown when a request
+// carries the instance token.
+func shutdownHandler(token string, shutdown func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(tokenHeader)), []byte(token)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		// Shut down after the response has been sent
+		go shutdown()
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,276 @@
+package pkg
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce is how long a file has to be quiet before browsers are told
+// to reload. Editors often emit several events for a single save.
+const reloadDebounce = 150 * time.Millisecond
+
+// reloadKeepAlive is the interval for comment frames that keep idle event
+// streams from being closed by proxies or the browser.
+const reloadKeepAlive = 30 * time.Second
+
+// reloader watches a directory tree and tells connected browser tabs to
+// reload when the file they are showing changes.
+type reloader struct {
+	root    string
+	watcher *fsnotify.Watcher
+
+	mu        sync.Mutex
+	clients   map[*reloadClient]struct{}
+	pending   map[string]*time.Timer
+	listeners []func(changed string)
+	closed    bool
+}
+
+// reloadClient is a single browser tab subscribed to reload events.
+type reloadClient struct {
+	path   string // URL path of the page shown in the tab
+	dir    bool   // true if the page is a directory listing
+	all    bool   // true if the page depends on every file, like the report
+	events chan string
+}
+
+func newReloader(root string) (*reloader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	r := &reloader{
+		root:    root,
+		watcher: watcher,
+		clients: make(map[*reloadClient]struct{}),
+		pending: make(map[string]*time.Timer),
+	}
+
+	// fsnotify is not recursive, so every directory is watched on its own.
+	// Watching directories instead of files also keeps working when an
+	// editor saves by writing a temporary file and renaming it.
+	if err := r.watchTree(root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go r.run()
+	return r, nil
+}
+
+// watchTree adds a watch for dir and all of its subdirectories.
+func (r *reloader) watchTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// The directory may have vanished between the event and the walk
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != r.root && skipDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		if err := r.watcher.Add(p); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+func (r *reloader) run() {
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			r.handleEvent(event)
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v", err)
+		}
+	}
+}
+
+func (r *reloader) handleEvent(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := r.watchTree(event.Name); err != nil {
+				log.Printf("Error: %v", err)
+			}
+		}
+	}
+
+	rel, err := filepath.Rel(r.root, event.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	urlPath := "/" + filepath.ToSlash(rel)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if t, ok := r.pending[urlPath]; ok {
+		t.Reset(reloadDebounce)
+		return
+	}
+	r.pending[urlPath] = time.AfterFunc(reloadDebounce, func() {
+		r.mu.Lock()
+		delete(r.pending, urlPath)
+		listeners := r.listeners
+		r.mu.Unlock()
+
+		// Update derived state before tabs reload and ask for it
+		for _, listener := range listeners {
+			listener(urlPath)
+		}
+		r.notify(urlPath)
+	})
+}
+
+// onChange registers a function that is called with the URL path of every
+// changed file or directory, after debouncing
+func (r *reloader) onChange(listener func(changed string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, listener)
+}
+
+// notify sends a reload event to every tab showing the changed path.
+func (r *reloader) notify(changed string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for c := range r.clients {
+		if !c.matches(changed) {
+			continue
+		}
+		select {
+		case c.events <- changed:
+		default:
+			// A reload is already queued for this tab
+		}
+	}
+}
+
+// matches reports whether a change to the given URL path affects the page
+// shown by the client.
+func (c *reloadClient) matches(changed string) bool {
+	if changed == c.path || c.all {
+		return true
+	}
+	if !c.dir || !isMarkdownPath(changed) {
+		return false
+	}
+	// Directory listings show every markdown file below them
+	prefix := strings.TrimSuffix(c.path, "/") + "/"
+	return strings.HasPrefix(changed, prefix)
+}
+
+// ServeHTTP streams reload events for the page given in the path query
+// parameter using server-sent events.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	page := path.Clean("/" + req.URL.Query().Get("path"))
+	info, err := os.Stat(filepath.Join(r.root, filepath.FromSlash(page)))
+	client := &reloadClient{
+		path:   page,
+		dir:    err == nil && info.IsDir(),
+		all:    page == reportPath,
+		events: make(chan string, 1),
+	}
+
+	// The event stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.clients[client] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, client)
+		r.mu.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(reloadKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case changed, ok := <-client.events:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: reload\ndata: %s\n\n", changed)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the file watcher and disconnects all browser tabs.
+func (r *reloader) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for _, t := range r.pending {
+		t.Stop()
+	}
+	for c := range r.clients {
+		close(c.events)
+		delete(r.clients, c)
+	}
+	r.mu.Unlock()
+
+	return r.watcher.Close()
+}
+
+// skipDir reports whether a directory is excluded from scanning and watching.
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor"
+}
+
+func isMarkdownPath(p string) bool {
+	return strings.HasSuffix(strings.ToLower(p), ".md")
+}
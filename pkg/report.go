@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// reportPath is the URL path of the report page of a site
+const reportPath = "/_report"
+
+// Sections of the report, by kind of problem
+var reportSections = []struct {
+	kind  string
+	title string
+}{
+	{KindRender, "💥 Broken Documents"},
+	{KindLink, "🔗 Broken Links"},
+	{KindAnchor, "⚓ Broken Anchors"},
+	{KindImage, "🖼️ Missing Images"},
+	{KindWiki, "📝 Unresolved Wiki Links"},
+}
+
+// reportCache keeps the problems found in a directory until a file changes
+type reportCache struct {
+	directory string
+	parser    *Parser
+
+	checking sync.Mutex // Held while checking, so only one check runs
+
+	mu         sync.Mutex
+	generation int // Incremented on every change
+	checked    int // Generation of the cached problems, -1 for none
+	problems   []Diagnostic
+}
+
+func newReportCache(directory string, parser *Parser) *reportCache {
+	return &reportCache{directory: directory, parser: parser, checked: -1}
+}
+
+// diagnostics returns the problems of the directory, checking it only if a
+// file changed since the last check
+func (c *reportCache) diagnostics() ([]Diagnostic, error) {
+	c.checking.Lock()
+	defer c.checking.Unlock()
+
+	c.mu.Lock()
+	generation := c.generation
+	if c.checked == generation {
+		problems := c.problems
+		c.mu.Unlock()
+		return problems, nil
+	}
+	c.mu.Unlock()
+
+	problems, err := NewChecker(c.parser).Check(c.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.problems, c.checked = problems, generation
+	c.mu.Unlock()
+	return problems, nil
+}
+
+// invalidate drops the cached problems after a file changed
+func (c *reportCache) invalidate(changed string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+}
+
+// GenerateReportMarkdown generates markdown content for the report page,
+// listing the problems found by the Checker in directory and the orphan
+// pages. Documents are linked by their path below directory.
+func GenerateReportMarkdown(directory string, diagnostics []Diagnostic, orphans []string) string {
+	var sb strings.Builder
+
+	sb.WriteString("# 🩺 Documentation Report\n\n")
+	sb.WriteString(fmt.Sprintf("**Problems:** %d\n\n", len(diagnostics)))
+	sb.WriteString(fmt.Sprintf("**Orphan Pages:** %d\n\n", len(orphans)))
+	sb.WriteString("---\n\n")
+
+	if len(diagnostics) == 0 && len(orphans) == 0 {
+		sb.WriteString("✅ No problems found\n")
+		return sb.String()
+	}
+
+	for _, section := range reportSections {
+		var rows []string
+		for _, d := range diagnostics {
+			if d.Kind != section.kind {
+				continue
+			}
+			page := d.File
+			if rel, err := filepath.Rel(directory, d.File); err == nil {
+				page = "/" + filepath.ToSlash(rel)
+			}
+			rows = append(rows, fmt.Sprintf("| [%s](%s) | %d | %s | %s |",
+				escapeMarkdown(page), escapePath(page), d.Line, escapeMarkdown(d.Target), escapeMarkdown(d.Message)))
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("## %s (%d)\n\n", section.title, len(rows)))
+		sb.WriteString("| Document | Line | Target | Problem |\n")
+		sb.WriteString("| --- | --- | --- | --- |\n")
+		sb.WriteString(strings.Join(rows, "\n"))
+		sb.WriteString("\n\n")
+	}
+
+	if len(orphans) > 0 {
+		sb.WriteString(fmt.Sprintf("## 🏝️ Orphan Pages (%d)\n\n", len(orphans)))
+		sb.WriteString("No other page links to these pages:\n\n")
+		for _, page := range orphans {
+			sb.WriteString(fmt.Sprintf("- [%s](%s)\n", escapeMarkdown(page), escapePath(page)))
+		}
+	}
+
+	return sb.String()
+}
+
+// escapeMarkdown escapes text for a table cell or link text. Escaped
+// brackets also keep wiki links in the text from being turned into links.
+// HTML is written as entities, the parser keeps escaped tags as html.
+func escapeMarkdown(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '<':
+			sb.WriteString("&lt;")
+		case r == '>':
+			sb.WriteString("&gt;")
+		case r == '&':
+			sb.WriteString("&amp;")
+		case strings.ContainsRune("\\`*_{}[]()#+-.!|~$", r):
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
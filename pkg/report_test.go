@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReportCache(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "README.md")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(c *reportCache) int {
+		t.Helper()
+		diagnostics, err := c.diagnostics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(diagnostics)
+	}
+
+	write("[missing](missing.md)\n")
+	c := newReportCache(root, NewParser("light"))
+	if got := count(c); got != 1 {
+		t.Fatalf("got %d problems, want 1", got)
+	}
+
+	// The problems are kept until a change is reported
+	write("# Fixed\n")
+	if got := count(c); got != 1 {
+		t.Errorf("got %d problems before the change was reported, want the cached 1", got)
+	}
+	c.invalidate("/README.md")
+	if got := count(c); got != 0 {
+		t.Errorf("got %d problems after the change, want 0", got)
+	}
+}
@@ -0,0 +1,444 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Weights of the fields a search term can be found in. Hits in titles and
+// headings rank above hits in the body text.
+const (
+	weightTitle   = 10.0
+	weightTag     = 6.0
+	weightHeading = 4.0
+	weightBody    = 1.0
+
+	// maxBodyHits caps how much repeating a word in the body counts
+	maxBodyHits = 5
+	// maxSearchResults is the number of results returned for a query
+	maxSearchResults = 20
+	// snippetLength is the approximate length of result snippets in runes
+	snippetLength = 160
+)
+
+type searchField int
+
+const (
+	fieldTitle searchField = iota
+	fieldTag
+	fieldHeading
+	fieldBody
+)
+
+// searchIndex is an in-memory inverted index over the markdown files of a
+// directory. It is built on the first query and kept up to date afterwards.
+type searchIndex struct {
+	root string
+	gfm  bool // Read the files with the gfm extensions
+
+	once  sync.Once
+	mu    sync.RWMutex
+	built bool
+	docs  map[string]*searchDoc           // URL path -> document
+	terms map[string]map[string][]posting // term -> URL path -> postings
+}
+
+// searchDoc is the searchable content of a single markdown file
+type searchDoc struct {
+	path     string
+	title    string
+	tags     []string
+	sections []searchSection
+	terms    map[string]bool // Terms of the document, to remove it again
+}
+
+// searchSection is the text below a heading, the first section holds the
+// text before the first heading
+type searchSection struct {
+	heading string
+	anchor  string
+	text    string
+}
+
+// posting records a single occurrence of a term
+type posting struct {
+	field   searchField
+	section int
+}
+
+// searchResult is a single hit returned by the search endpoint
+type searchResult struct {
+	Path    string  `json:"path"`
+	URL     string  `json:"url"`
+	Title   string  `json:"title"`
+	Heading string  `json:"heading,omitempty"`
+	Anchor  string  `json:"anchor,omitempty"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+func newSearchIndex(root string, gfm bool) *searchIndex {
+	return &searchIndex{
+		root:  root,
+		gfm:   gfm,
+		docs:  make(map[string]*searchDoc),
+		terms: make(map[string]map[string][]posting),
+	}
+}
+
+// build indexes all markdown files once
+func (idx *searchIndex) build() {
+	idx.once.Do(func() {
+		toc, err := ScanMarkdownFiles(idx.root, idx.gfm)
+		if err != nil {
+			log.Printf("Error scanning directory: %v", err)
+			return
+		}
+
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+		idx.built = true
+		for _, file := range toc.Files {
+			idx.indexFile("/"+filepath.ToSlash(file.Path), file)
+		}
+	})
+}
+
+// update brings the index up to date after a file or directory changed
+func (idx *searchIndex) update(changed string) {
+	fullPath := filepath.Join(idx.root, filepath.FromSlash(changed))
+	info, statErr := os.Stat(fullPath)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// Nothing to update before the index has been built
+	if !idx.built {
+		return
+	}
+
+	// Drop the file, or everything below a removed or renamed directory
+	dirPrefix := strings.TrimSuffix(changed, "/") + "/"
+	for p := range idx.docs {
+		if p == changed || strings.HasPrefix(p, dirPrefix) {
+			idx.removeDoc(p)
+		}
+	}
+	if statErr != nil {
+		return
+	}
+
+	if info.IsDir() {
+		toc, err := ScanMarkdownFiles(fullPath, idx.gfm)
+		if err != nil {
+			return
+		}
+		for _, file := range toc.Files {
+			idx.indexFile(path.Join(changed, filepath.ToSlash(file.Path)), file)
+		}
+		return
+	}
+
+	if isMarkdownPath(changed) {
+		meta := readFileMeta(fullPath, info, idx.gfm)
+		idx.indexFile(changed, MarkdownFile{
+			Path:     strings.TrimPrefix(changed, "/"),
+			Title:    meta.title,
+			FullPath: fullPath,
+			Hidden:   meta.hidden,
+		})
+	}
+}
+
+// indexFile adds a markdown file to the index, the caller holds the lock.
+// Drafts and hidden files are left out like in the navigation.
+func (idx *searchIndex) indexFile(urlPath string, file MarkdownFile) {
+	if file.Hidden {
+		return
+	}
+	content, err := os.ReadFile(file.FullPath)
+	if err != nil {
+		return
+	}
+
+	doc := extractSearchDoc(content, idx.gfm)
+	doc.path = urlPath
+	doc.title = file.Title
+	doc.terms = make(map[string]bool)
+
+	add := func(text string, field searchField, section int) {
+		for _, term := range tokenize(text) {
+			if idx.terms[term] == nil {
+				idx.terms[term] = make(map[string][]posting)
+			}
+			idx.terms[term][urlPath] = append(idx.terms[term][urlPath], posting{field: field, section: section})
+			doc.terms[term] = true
+		}
+	}
+
+	add(doc.title, fieldTitle, 0)
+	for _, tag := range doc.tags {
+		add(tag, fieldTag, 0)
+	}
+	for i, section := range doc.sections {
+		add(section.heading, fieldHeading, i)
+		add(section.text, fieldBody, i)
+	}
+
+	idx.docs[urlPath] = doc
+}
+
+// removeDoc drops a document from the index, the caller holds the lock
+func (idx *searchIndex) removeDoc(urlPath string) {
+	doc, ok := idx.docs[urlPath]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(idx.terms[term], urlPath)
+		if len(idx.terms[term]) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+	delete(idx.docs, urlPath)
+}
+
+// search returns the best matching documents. Every query term has to
+// match, the last one may also match as a prefix while the user types.
+func (idx *searchIndex) search(query string) []searchResult {
+	idx.build()
+
+	queryTerms := tokenize(query)
+	if len(queryTerms) == 0 {
+		return []searchResult{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	scores := map[string]float64{}
+	sectionScores := map[string]map[int]float64{}
+	for i, qt := range queryTerms {
+		matched := map[string]bool{}
+		for term, docs := range idx.terms {
+			factor := 1.0
+			if term != qt {
+				if i != len(queryTerms)-1 || !strings.HasPrefix(term, qt) {
+					continue
+				}
+				factor = 0.5
+			}
+
+			for p, postings := range docs {
+				if i > 0 && scores[p] == 0 {
+					// Already missed an earlier term
+					continue
+				}
+				matched[p] = true
+				if sectionScores[p] == nil {
+					sectionScores[p] = map[int]float64{}
+				}
+
+				bodyHits := 0
+				for _, hit := range postings {
+					switch hit.field {
+					case fieldTitle:
+						scores[p] += weightTitle * factor
+					case fieldTag:
+						scores[p] += weightTag * factor
+					case fieldHeading:
+						scores[p] += weightHeading * factor
+						sectionScores[p][hit.section] += weightHeading
+					case fieldBody:
+						sectionScores[p][hit.section] += weightBody
+						if bodyHits < maxBodyHits {
+							scores[p] += weightBody * factor
+							bodyHits++
+						}
+					}
+				}
+			}
+		}
+
+		// Documents missing this term are out
+		for p := range scores {
+			if !matched[p] {
+				delete(scores, p)
+			}
+		}
+	}
+
+	results := []searchResult{}
+	for p, score := range scores {
+		doc := idx.docs[p]
+		result := searchResult{
+			Path:  p,
+			URL:   p,
+			Title: doc.title,
+			Score: score,
+		}
+
+		// Point to the section with the most hits
+		best, bestScore := 0, -1.0
+		for i, s := range sectionScores[p] {
+			if s > bestScore || (s == bestScore && i < best) {
+				best, bestScore = i, s
+			}
+		}
+		if best < len(doc.sections) {
+			section := doc.sections[best]
+			result.Heading = section.heading
+			result.Anchor = section.anchor
+			if section.anchor != "" {
+				result.URL += "#" + section.anchor
+			}
+			result.Snippet = snippet(section.text, queryTerms)
+		}
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if len(results) > maxSearchResults {
+		results = results[:maxSearchResults]
+	}
+	return results
+}
+
+// serve answers /_search?q= with the results as JSON, their URLs below the
+// escaped prefix of the mount
+func (idx *searchIndex) serve(w http.ResponseWriter, r *http.Request, prefix string) {
+	results := idx.search(r.URL.Query().Get("q"))
+	for i := range results {
+		results[i].URL = prefix + results[i].URL
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+// extractSearchDoc collects the tags and the text of every section
+func extractSearchDoc(content []byte, gfm bool) *searchDoc {
+	cleanContent, frontmatter := extractFrontmatter(content)
+	doc := &searchDoc{
+		tags:     frontmatterTags(frontmatter),
+		sections: []searchSection{{}},
+	}
+
+	var heading, text strings.Builder
+	inHeading := false
+	flush := func() {
+		last := &doc.sections[len(doc.sections)-1]
+		last.text = strings.Join(strings.Fields(text.String()), " ")
+		text.Reset()
+	}
+
+	ast.WalkFunc(parseMarkdown(cleanContent, gfm), func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Heading:
+			if entering {
+				flush()
+				heading.Reset()
+				doc.sections = append(doc.sections, searchSection{anchor: n.HeadingID})
+				inHeading = true
+			} else {
+				doc.sections[len(doc.sections)-1].heading = strings.TrimSpace(heading.String())
+				inHeading = false
+			}
+		case *ast.HTMLBlock, *ast.HTMLSpan:
+			// Markup is not searchable text
+		default:
+			leaf := node.AsLeaf()
+			if leaf == nil || !entering {
+				break
+			}
+			if inHeading {
+				heading.Write(leaf.Literal)
+			} else {
+				text.Write(leaf.Literal)
+				text.WriteByte(' ')
+			}
+		}
+		return ast.GoToNext
+	})
+	flush()
+
+	return doc
+}
+
+// frontmatterTags returns the tags given as list or comma separated string
+func frontmatterTags(frontmatter Frontmatter) []string {
+	var tags []string
+	switch v := frontmatter["tags"].(type) {
+	case []interface{}:
+		for _, tag := range v {
+			tags = append(tags, fmt.Sprintf("%v", tag))
+		}
+	case string:
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// tokenize splits text into lowercase words of at least two characters
+func tokenize(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) >= 2 {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// snippet cuts a part of text around the first query term
+func snippet(text string, queryTerms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+
+	start := -1
+	for _, qt := range queryTerms {
+		if i := strings.Index(string(lower), qt); i >= 0 {
+			// Convert the byte offset into a rune offset
+			start = len([]rune(string(lower)[:i]))
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	from := max(start-snippetLength/3, 0)
+	to := min(from+snippetLength, len(runes))
+	s := string(runes[from:to])
+	if from > 0 {
+		s = "…" + s
+	}
+	if to < len(runes) {
+		s += "…"
+	}
+	return s
+}
@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchSkipsHiddenPages(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("public.md", "# Public\n\nzebra\n")
+	write("draft.md", "---\ndraft: true\n---\n# Draft\n\nzebra\n")
+
+	idx := newSearchIndex(root, false)
+	paths := func() []string {
+		var paths []string
+		for _, result := range idx.search("zebra") {
+			paths = append(paths, result.Path)
+		}
+		return paths
+	}
+	if got := paths(); len(got) != 1 || got[0] != "/public.md" {
+		t.Errorf("search found %v, want only /public.md", got)
+	}
+
+	// Files hidden after the index was built are removed from it
+	write("public.md", "---\nhidden: true\n---\n# Public\n\nzebra\n")
+	idx.update("/public.md")
+	if got := paths(); len(got) != 0 {
+		t.Errorf("search found %v after hiding, want nothing", got)
+	}
+}
@@ -2,24 +2,31 @@ package pkg
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"text/template"
 	"time"
 
-	// "github.com/aarol/reload"
-	chroma_html "github.com/alecthomas/chroma/v2/formatters/html"
-	"github.com/alecthomas/chroma/v2/styles"
 	"github.com/chrishrb/go-grip/defaults"
 )
 
+// shutdownTimeout is how long requests in flight may take to finish
+// when the server shuts down
+const shutdownTimeout = 10 * time.Second
+
 type Server struct {
 	parser      *Parser
 	theme       string
@@ -27,9 +34,21 @@ type Server struct {
 	host        string
 	port        int
 	browser     bool
+	idleTimeout time.Duration
+
+	mu      sync.Mutex
+	sites   map[*site]struct{}
+	servers map[*http.Server]struct{}
 }
 
 func NewServer(host string, port int, theme string, boundingBox bool, browser bool, parser *Parser) *Server {
+	validThemes := map[string]bool{"light": true, "dark": true, "auto": true}
+
+	if !validThemes[theme] {
+		log.Println("Warning: Unknown theme ", theme, ", defaulting to 'auto'")
+		theme = "auto"
+	}
+
 	return &Server{
 		host:        host,
 		port:        port,
@@ -37,189 +56,182 @@ func NewServer(host string, port int, theme string, boundingBox bool, browser bo
 		boundingBox: boundingBox,
 		browser:     browser,
 		parser:      parser,
+		sites:       make(map[*site]struct{}),
+		servers:     make(map[*http.Server]struct{}),
 	}
 }
 
-func (s *Server) Serve(inputPath string) error {
-	var directory string
-	var initialFile string
+// SetIdleTimeout makes Serve and ServeMounts shut down once no page has been
+// requested for the given duration. Zero disables the timeout.
+func (s *Server) SetIdleTimeout(d time.Duration) {
+	s.idleTimeout = d
+}
 
-	log.Printf("Starting server with inputPath: %s", inputPath)
+// Handler returns an http.Handler that serves the markdown files below the
+// root directory, including live reload. It does not touch any global state,
+// so several handlers can be mounted side by side in another router. Call
+// Shutdown to stop watching root.
+func (s *Server) Handler(root string) (http.Handler, error) {
+	return s.HandlerAt(root, "")
+}
 
-	// Check if input is a file or directory
-	info, err := os.Stat(inputPath)
+// HandlerAt is like Handler for a handler mounted below prefix with
+// http.StripPrefix, e.g. /docs. Generated links keep the prefix.
+func (s *Server) HandlerAt(root string, prefix string) (http.Handler, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("invalid prefix: %q", prefix)
+	}
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("directory not found: %s", root)
+	}
+	absDir, err := filepath.Abs(root)
 	if err != nil {
-		// If file doesn't exist, check if parent directory exists
-		directory = path.Dir(inputPath)
-		initialFile = path.Base(inputPath)
-		if _, err := os.Stat(directory); err != nil {
-			return fmt.Errorf("path not found: %s", inputPath)
-		}
-	} else if info.IsDir() {
-		directory = inputPath
-		// Don't set an initial file - show TOC by default
-	} else {
-		directory = path.Dir(inputPath)
-		initialFile = path.Base(inputPath)
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
+	return s.newSite(absDir, prefix)
+}
 
-	// Convert to absolute path for consistent handling
-	absDir, err := filepath.Abs(directory)
+// newSite creates a site for directory mounted below prefix and tracks it
+// for Shutdown
+func (s *Server) newSite(directory string, prefix string) (*site, error) {
+	st, err := newSite(s, directory, prefix)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+		return nil, err
 	}
-	directory = absDir
-	log.Printf("Serving directory: %s, initial file: %s", directory, initialFile)
+	s.mu.Lock()
+	s.sites[st] = struct{}{}
+	s.mu.Unlock()
+	return st, nil
+}
 
-	// Configure reload with more conservative settings
-	// Temporarily disable reload for debugging
-	// reload := reload.New(directory)
-	// reload.DebugLog = log.New(io.Discard, "", 0)
+// closeSite stops watching the directory of a site
+func (s *Server) closeSite(st *site) {
+	s.mu.Lock()
+	delete(s.sites, st)
+	s.mu.Unlock()
+	st.Close()
+}
 
-	validThemes := map[string]bool{"light": true, "dark": true, "auto": true}
+// Shutdown gracefully stops all servers started with Serve or ServeMounts
+// and releases the file watchers of all handlers. Open live reload streams
+// are closed first, as they would otherwise keep the servers busy.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	sites := s.sites
+	servers := s.servers
+	s.sites = make(map[*site]struct{})
+	s.servers = make(map[*http.Server]struct{})
+	s.mu.Unlock()
+
+	for st := range sites {
+		st.Close()
+	}
 
-	if !validThemes[s.theme] {
-		log.Println("Warning: Unknown theme ", s.theme, ", defaulting to 'auto'")
-		s.theme = "auto"
+	var errs []error
+	for server := range servers {
+		errs = append(errs, server.Shutdown(ctx))
 	}
+	return errors.Join(errs...)
+}
 
-	dir := http.Dir(directory)
-	chttp := http.NewServeMux()
-	chttp.Handle("/static/", http.FileServer(http.FS(defaults.StaticFiles)))
+// Mount is a documentation root served below a URL prefix
+type Mount struct {
+	Name      string `json:"name"`      // URL prefix without slashes, empty for the root
+	Directory string `json:"directory"` // Absolute path of the served directory
+}
 
-	// Regex for markdown
-	regex := regexp.MustCompile(`(?i)\.md$`)
+// Serve serves a single file or directory at the root of the server
+func (s *Server) Serve(inputPath string) error {
+	log.Printf("Starting server with inputPath: %s", inputPath)
 
-	// Serve website with rendered markdown
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Add connection timeout and error recovery
-		defer func() {
-			if err := recover(); err != nil {
-				log.Printf("Recovered from panic: %v", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			}
-		}()
-		urlPath := r.URL.Path
+	directory, initialFile, err := ResolveInput(inputPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving directory: %s, initial file: %s", directory, initialFile)
 
-		// Remove leading slash and clean the path
-		if urlPath == "/" || urlPath == "" {
-			// For root path, generate TOC for the entire directory
-			toc, err := ScanMarkdownFiles(directory)
-			if err != nil {
-				log.Printf("Error scanning directory: %v", err)
-				http.Error(w, "Failed to scan directory", http.StatusInternalServerError)
-				return
-			}
+	return s.serve([]Mount{{Directory: directory}}, initialFile)
+}
 
-			// Generate TOC markdown
-			tocMarkdown := GenerateTOCMarkdown(toc)
-			
-			// Parse the TOC markdown to HTML
-			htmlContent := s.parser.MdToHTML([]byte(tocMarkdown))
-			
-			// Serve the TOC page
-			err = serveTemplate(w, htmlStruct{
-				Content:      string(htmlContent),
-				Theme:        s.theme,
-				BoundingBox:  s.boundingBox,
-				CssCodeLight: getCssCode("github"),
-				CssCodeDark:  getCssCode("github-dark"),
-			})
-			if err != nil {
-				http.Error(w, "Failed to render template", http.StatusInternalServerError)
-				return
-			}
-			return
-		}
+// ServeMounts serves several documentation roots from one server, each below
+// its own URL prefix, with a landing page listing them at the root.
+func (s *Server) ServeMounts(mounts []Mount) error {
+	if len(mounts) == 0 {
+		return fmt.Errorf("no mounts given")
+	}
 
-		// Check if the path ends with a directory
-		fullPath := filepath.Join(directory, strings.TrimPrefix(urlPath, "/"))
-		if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
-			// Generate TOC for this subdirectory
-			toc, err := ScanMarkdownFiles(fullPath)
-			if err != nil {
-				log.Printf("Error scanning directory: %v", err)
-				http.Error(w, "Failed to scan directory", http.StatusInternalServerError)
-				return
-			}
+	seen := map[string]bool{}
+	for i, m := range mounts {
+		if m.Name == "" || strings.ContainsAny(m.Name, `/\?#%`) || strings.HasPrefix(m.Name, "_") || m.Name == "static" {
+			return fmt.Errorf("invalid mount name: %q", m.Name)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("duplicate mount name: %q", m.Name)
+		}
+		seen[m.Name] = true
 
-			// Generate TOC markdown
-			tocMarkdown := GenerateTOCMarkdown(toc)
-			
-			// Parse the TOC markdown to HTML with proper link transformation
-			htmlContent := s.parseMarkdownWithLinks([]byte(tocMarkdown), urlPath)
-			
-			// Serve the TOC page
-			err = serveTemplate(w, htmlStruct{
-				Content:      string(htmlContent),
-				Theme:        s.theme,
-				BoundingBox:  s.boundingBox,
-				CssCodeLight: getCssCode("github"),
-				CssCodeDark:  getCssCode("github-dark"),
-			})
-			if err != nil {
-				http.Error(w, "Failed to render template", http.StatusInternalServerError)
-				return
-			}
-			return
+		info, err := os.Stat(m.Directory)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("mount %s: directory not found: %s", m.Name, m.Directory)
+		}
+		absDir, err := filepath.Abs(m.Directory)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
 		}
+		mounts[i].Directory = absDir
+		log.Printf("Mounting directory %s at /%s/", absDir, m.Name)
+	}
 
-		// Try to open the file
-		f, err := dir.Open(urlPath)
-		if err == nil {
-			defer f.Close()
+	return s.serve(mounts, "")
+}
+
+func (s *Server) serve(mounts []Mount, initialFile string) error {
+	mux := http.NewServeMux()
+	var sites []*site
+	defer func() {
+		for _, st := range sites {
+			s.closeSite(st)
 		}
+	}()
 
-		if err == nil && regex.MatchString(urlPath) {
-			// Open file and convert to html
-			bytes, err := readToString(dir, urlPath)
-			if err != nil {
-				http.Error(w, "Failed to read file", http.StatusInternalServerError)
-				return
-			}
+	for _, m := range mounts {
+		prefix := ""
+		if m.Name != "" {
+			prefix = "/" + m.Name
+		}
+		st, err := s.newSite(m.Directory, prefix)
+		if err != nil {
+			return err
+		}
+		sites = append(sites, st)
 
-			// Parse markdown with link transformation
-			htmlContent := s.parseMarkdownWithLinks(bytes, urlPath)
+		if prefix == "" {
+			mux.Handle("/", st)
+		} else {
+			mux.Handle(prefix+"/", http.StripPrefix(prefix, st))
+		}
+	}
 
-			// Serve
-			err = serveTemplate(w, htmlStruct{
-				Content:      string(htmlContent),
-				Theme:        s.theme,
-				BoundingBox:  s.boundingBox,
-				CssCodeLight: getCssCode("github"),
-				CssCodeDark:  getCssCode("github-dark"),
+	// With named mounts the root lists them
+	if mounts[0].Name != "" {
+		mux.Handle("/static/", newStaticHandler())
+		mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+			page := s.parser.Render([]byte(GenerateMountsMarkdown(mounts)))
+			err := serveTemplate(w, htmlStruct{
+				Content:        string(page.HTML),
+				Title:          page.Title,
+				Theme:          s.theme,
+				BoundingBox:    s.boundingBox,
+				CodeStyleLight: s.parser.codeStyleLight,
+				CodeStyleDark:  s.parser.codeStyleDark,
 			})
 			if err != nil {
 				http.Error(w, "Failed to render template", http.StatusInternalServerError)
-				return
-			}
-		} else if err == nil {
-			// Serve static files from the markdown directory
-			// Check if it's an image or other static file
-			info, err := f.Stat()
-			if err != nil {
-				http.Error(w, "Failed to stat file", http.StatusInternalServerError)
-				return
 			}
-			
-			// Don't serve directories
-			if info.IsDir() {
-				http.Error(w, "Not Found", http.StatusNotFound)
-				return
-			}
-			
-			// Serve the file
-			http.ServeFile(w, r, filepath.Join(directory, strings.TrimPrefix(urlPath, "/")))
-		} else {
-			// If file not found and it's a static asset request, serve from embedded files
-			if strings.HasPrefix(urlPath, "/static/") {
-				chttp.ServeHTTP(w, r)
-			} else {
-				// For non-static files, return a proper 404
-				http.Error(w, "File not found", http.StatusNotFound)
-			}
-		}
-	})
+		})
+	}
 
 	// Try to find an available port, starting with the requested one
 	listener, actualPort, err := s.findAvailablePort()
@@ -242,21 +254,140 @@ func (s *Server) Serve(inputPath string) error {
 	}
 
 	// Create a server with timeouts to prevent connection exhaustion
+	activity := newActivityTracker()
 	server := &http.Server{
-		Handler:      http.DefaultServeMux, // Temporarily disable reload
+		Handler:      activity.wrap(mux),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
-	
+	// Event streams never go idle, end them so Shutdown can complete
+	server.RegisterOnShutdown(func() {
+		for _, st := range sites {
+			st.Close()
+		}
+	})
+
+	s.mu.Lock()
+	s.servers[server] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.servers, server)
+		s.mu.Unlock()
+	}()
+
+	// Register in the instance registry so `go-grip list` and `go-grip stop` find us
+	instance := &Instance{
+		PID:         os.Getpid(),
+		Host:        s.host,
+		Port:        actualPort,
+		InitialFile: initialFile,
+		StartTime:   time.Now(),
+	}
+	if mounts[0].Name == "" {
+		instance.Directory = mounts[0].Directory
+	} else {
+		instance.Mounts = mounts
+	}
+	unregister, err := registerInstance(instance)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	defer unregister()
+
+	mux.Handle("/_api/health", healthHandler(Identity{
+		App:       appName,
+		PID:       instance.PID,
+		Directory: instance.Directory,
+		Mounts:    instance.Mounts,
+	}))
+	// Shut down gracefully: stop accepting connections, drain requests in
+	// flight, close the watchers and remove the registry entry
+	var stopping atomic.Bool
+	stopped := make(chan struct{})
+	shutdown := func(reason string) {
+		if !stopping.CompareAndSwap(false, true) {
+			return
+		}
+		defer close(stopped)
+		log.Printf("Shutting down: %s", reason)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown error: %v", err)
+		}
+	}
+
+	mux.Handle("/_api/shutdown", shutdownHandler(instance.Token, func() {
+		shutdown("requested by go-grip stop")
+	}))
+
+	served := make(chan struct{})
+	defer close(served)
+
+	// Ctrl-C and SIGTERM, a second signal terminates immediately
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		select {
+		case <-signals.Done():
+			stopSignals()
+			shutdown("received signal")
+		case <-served:
+		}
+	}()
+
+	if s.idleTimeout > 0 {
+		go activity.watch(s.idleTimeout, served, func() {
+			shutdown(fmt.Sprintf("idle for %s", s.idleTimeout))
+		})
+	}
+
 	log.Printf("Starting HTTP server on %s", listener.Addr())
 	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve returns as soon as shutdown starts, wait for the draining
+		if stopping.Load() {
+			<-stopped
+		}
+		return nil
+	}
 	if err != nil {
 		log.Printf("Server error: %v", err)
 	}
 	return err
 }
 
+// ResolveInput splits the path given on the command line into the absolute
+// directory to serve and the file to open initially, if any.
+func ResolveInput(inputPath string) (directory string, initialFile string, err error) {
+	// Check if input is a file or directory
+	info, err := os.Stat(inputPath)
+	if err != nil {
+		// If file doesn't exist, check if parent directory exists
+		directory = path.Dir(inputPath)
+		initialFile = path.Base(inputPath)
+		if _, err := os.Stat(directory); err != nil {
+			return "", "", fmt.Errorf("path not found: %s", inputPath)
+		}
+	} else if info.IsDir() {
+		directory = inputPath
+		// Don't set an initial file - show TOC by default
+	} else {
+		directory = path.Dir(inputPath)
+		initialFile = path.Base(inputPath)
+	}
+
+	// Convert to absolute path for consistent handling
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return absDir, initialFile, nil
+}
+
 func readToString(dir http.Dir, filename string) ([]byte, error) {
 	f, err := dir.Open(filename)
 	if err != nil {
@@ -273,15 +404,30 @@ func readToString(dir http.Dir, filename string) ([]byte, error) {
 }
 
 type htmlStruct struct {
-	Content      string
-	Theme        string
-	BoundingBox  bool
-	CssCodeLight string
-	CssCodeDark  string
+	Content        string
+	Title          string // Title of the browser tab
+	Description    string // Description of the page for search engines
+	Layout         string // Page layout, empty for the default layout
+	Theme          string
+	BoundingBox    bool
+	CodeStyleLight string // Chroma style of code blocks in light mode
+	CodeStyleDark  string // Chroma style of code blocks in dark mode
+	Prefix         string // URL prefix of the mount the page belongs to
+	Path           string // URL path of the page within its mount
+	Nav            *navigation
+	Headings       []Heading // Outline of the page
+	Backlinks      []navLink // Pages linking to the page
+	LiveReload     bool
+	Search         bool
 }
 
 func serveTemplate(w http.ResponseWriter, html htmlStruct) error {
 	w.Header().Set("Content-Type", "text/html")
+	return renderTemplate(w, html)
+}
+
+// renderTemplate renders the page layout
+func renderTemplate(w io.Writer, html htmlStruct) error {
 	tmpl, err := template.ParseFS(defaults.Templates, "templates/layout.html")
 	if err != nil {
 		return err
@@ -290,86 +436,6 @@ func serveTemplate(w http.ResponseWriter, html htmlStruct) error {
 	return err
 }
 
-func getCssCode(style string) string {
-	buf := new(strings.Builder)
-	formatter := chroma_html.New(chroma_html.WithClasses(true))
-	s := styles.Get(style)
-	_ = formatter.WriteCSS(buf, s)
-	return buf.String()
-}
-
-// parseMarkdownWithLinks processes markdown content and transforms relative links
-func (s *Server) parseMarkdownWithLinks(content []byte, currentPath string) []byte {
-	// First, preprocess wiki-style links [[text]] -> [text](text.md)
-	processedContent := s.preprocessWikiLinks(content)
-
-	// Then parse the markdown to HTML
-	htmlContent := s.parser.MdToHTML(processedContent)
-
-	// Transform relative markdown links to work with our server
-	// This regex matches markdown links like [text](path.md)
-	linkRegex := regexp.MustCompile(`href="([^"]+\.md(?:#[^"]*)?)"`)
-
-	currentDir := path.Dir(currentPath)
-
-	transformed := linkRegex.ReplaceAllFunc(htmlContent, func(match []byte) []byte {
-		// Extract the link
-		submatch := linkRegex.FindSubmatch(match)
-		if len(submatch) < 2 {
-			return match
-		}
-
-		link := string(submatch[1])
-
-		// Handle absolute paths (starting with /)
-		if strings.HasPrefix(link, "/") {
-			return match
-		}
-
-		// Handle relative paths
-		// Resolve the path relative to the current file's directory
-		resolvedPath := path.Join(currentDir, link)
-
-		// Make sure the path starts with /
-		if !strings.HasPrefix(resolvedPath, "/") {
-			resolvedPath = "/" + resolvedPath
-		}
-
-		return []byte(fmt.Sprintf(`href="%s"`, resolvedPath))
-	})
-
-	return transformed
-}
-
-// preprocessWikiLinks converts [[wiki links]] to standard markdown links
-func (s *Server) preprocessWikiLinks(content []byte) []byte {
-	// Regex to match [[text]] patterns
-	wikiLinkRegex := regexp.MustCompile(`\[\[([^\]]+)\]\]`)
-
-	return wikiLinkRegex.ReplaceAllFunc(content, func(match []byte) []byte {
-		// Extract the text between [[ and ]]
-		submatch := wikiLinkRegex.FindSubmatch(match)
-		if len(submatch) < 2 {
-			return match
-		}
-
-		linkText := string(submatch[1])
-
-		// Convert to filename: lowercase, spaces to hyphens
-		filename := strings.ToLower(linkText)
-		filename = strings.ReplaceAll(filename, " ", "-")
-		// Handle multiple spaces or special characters
-		filename = regexp.MustCompile(`[^a-z0-9-]+`).ReplaceAllString(filename, "-")
-		// Remove leading/trailing hyphens
-		filename = strings.Trim(filename, "-")
-		// Collapse multiple hyphens
-		filename = regexp.MustCompile(`-+`).ReplaceAllString(filename, "-")
-
-		// Wiki links always resolve from root with leading slash
-		return []byte(fmt.Sprintf("[%s](/%s.md)", linkText, filename))
-	})
-}
-
 // findAvailablePort tries to listen on the requested port first,
 // if that fails, it tries to find any available port
 func (s *Server) findAvailablePort() (net.Listener, int, error) {
@@ -0,0 +1,426 @@
+package pkg
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// Regex for markdown
+	markdownRegex = regexp.MustCompile(`(?i)\.md$`)
+	// Regex for references to the embedded static files
+	staticLinkRegex = regexp.MustCompile(`(href|src)="/static/`)
+	// Regex for absolute references like src="/pic.png"
+	absoluteLinkRegex = regexp.MustCompile(`(href|src)="(/[^"]*)"`)
+)
+
+// site serves a single documentation root. It may be mounted below a URL
+// prefix with http.StripPrefix, generated links then keep the prefix.
+type site struct {
+	server    *Server
+	directory string // Absolute path of the served directory
+	prefix    string // Escaped URL prefix the site is mounted below, empty at the root
+	reload    *reloader
+	index     *searchIndex
+	links     *wikiIndex
+	graph     *linkGraph
+	report    *reportCache
+	static    *staticHandler
+
+	mu       sync.Mutex
+	includes map[string][]string // URL paths of the files each page includes
+}
+
+func newSite(s *Server, directory string, prefix string) (*site, error) {
+	// Watch the directory and push reload events to open browser tabs
+	reload, err := newReloader(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the search index up to date with the files
+	index := newSearchIndex(directory, s.parser.gfm)
+	reload.onChange(index.update)
+
+	// Wiki links are resolved against the current files
+	links := newWikiIndex(directory, s.parser.gfm)
+	reload.onChange(links.invalidate)
+
+	// Keep track of which pages link to which
+	graph := newLinkGraph(directory, s.parser, links)
+	reload.onChange(graph.update)
+
+	// The report is checked again after files changed
+	report := newReportCache(directory, s.parser)
+	reload.onChange(report.invalidate)
+
+	st := &site{
+		server:    s,
+		directory: directory,
+		prefix:    escapePath(prefix),
+		reload:    reload,
+		index:     index,
+		links:     links,
+		graph:     graph,
+		report:    report,
+		static:    newStaticHandler(),
+		includes:  make(map[string][]string),
+	}
+	reload.onChange(st.reloadIncluders)
+	return st, nil
+}
+
+// reloadIncluders reloads the pages that include the changed file
+func (st *site) reloadIncluders(changed string) {
+	var pages []string
+	st.mu.Lock()
+	for page, deps := range st.includes {
+		if slices.Contains(deps, changed) {
+			pages = append(pages, page)
+		}
+	}
+	st.mu.Unlock()
+
+	for _, page := range pages {
+		st.reload.notify(page)
+	}
+}
+
+// Close stops watching the directory
+func (st *site) Close() error {
+	return st.reload.Close()
+}
+
+// Serve website with rendered markdown
+func (st *site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Add connection timeout and error recovery
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("Recovered from panic: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+	}()
+	urlPath := r.URL.Path
+	prefix := st.prefix
+	dir := http.Dir(st.directory)
+
+	// Live reload event stream
+	if urlPath == "/_events" {
+		st.reload.ServeHTTP(w, r)
+		return
+	}
+
+	// Full-text search
+	if urlPath == "/_search" {
+		st.index.serve(w, r, prefix)
+		return
+	}
+
+	// Pages linking to a page
+	if urlPath == "/_api/backlinks" {
+		st.graph.serve(w, r, prefix)
+		return
+	}
+
+	// Broken links and orphan pages of the whole tree
+	if urlPath == reportPath {
+		diagnostics, err := st.report.diagnostics()
+		if err != nil {
+			log.Printf("Error checking directory: %v", err)
+			http.Error(w, "Failed to check directory", http.StatusInternalServerError)
+			return
+		}
+		reportMarkdown := GenerateReportMarkdown(st.directory, diagnostics, st.graph.orphans())
+		page := st.parseMarkdownWithLinks([]byte(reportMarkdown), reportPath, prefix)
+		st.servePage(w, page, reportPath, prefix)
+		return
+	}
+
+	// Remove leading slash and clean the path
+	if urlPath == "/" || urlPath == "" {
+		// For root path, generate TOC for the entire directory
+		toc, err := ScanMarkdownFiles(st.directory, st.server.parser.gfm)
+		if err != nil {
+			log.Printf("Error scanning directory: %v", err)
+			http.Error(w, "Failed to scan directory", http.StatusInternalServerError)
+			return
+		}
+
+		// Generate TOC markdown
+		tocMarkdown := GenerateTOCMarkdown(toc)
+
+		// Parse the TOC markdown to HTML with the mount prefix applied
+		page := st.parseMarkdownWithLinks([]byte(tocMarkdown), "/", prefix)
+
+		// Serve the TOC page
+		st.servePage(w, page, "/", prefix)
+		return
+	}
+
+	// Check if the path ends with a directory
+	fullPath := filepath.Join(st.directory, strings.TrimPrefix(urlPath, "/"))
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		// Generate TOC for this subdirectory
+		toc, err := ScanMarkdownFiles(fullPath, st.server.parser.gfm)
+		if err != nil {
+			log.Printf("Error scanning directory: %v", err)
+			http.Error(w, "Failed to scan directory", http.StatusInternalServerError)
+			return
+		}
+
+		// Generate TOC markdown
+		tocMarkdown := GenerateTOCMarkdown(toc)
+
+		// Parse the TOC markdown to HTML with proper link transformation,
+		// TOC links are relative to the listed directory
+		page := st.parseMarkdownWithLinks([]byte(tocMarkdown), strings.TrimSuffix(urlPath, "/")+"/", prefix)
+
+		// Serve the TOC page
+		st.servePage(w, page, urlPath, prefix)
+		return
+	}
+
+	// Try to open the file
+	f, err := dir.Open(urlPath)
+	if err == nil {
+		defer f.Close()
+	}
+
+	if err == nil && markdownRegex.MatchString(urlPath) {
+		// Open file and convert to html
+		bytes, err := readToString(dir, urlPath)
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+
+		// Parse markdown with link transformation
+		page := st.parseMarkdownWithLinks(bytes, urlPath, prefix)
+
+		// Serve
+		st.servePage(w, page, urlPath, prefix)
+	} else if err == nil {
+		// Serve static files from the markdown directory
+		// Check if it's an image or other static file
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, "Failed to stat file", http.StatusInternalServerError)
+			return
+		}
+
+		// Don't serve directories
+		if info.IsDir() {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		// Serve the file
+		http.ServeFile(w, r, fullPath)
+	} else {
+		// If file not found and it's a static asset request, serve from embedded files
+		if strings.HasPrefix(urlPath, "/static/") {
+			st.static.ServeHTTP(w, r)
+		} else {
+			// For non-static files, return a proper 404
+			http.Error(w, "File not found", http.StatusNotFound)
+		}
+	}
+}
+
+// servePage renders a page into the page layout
+func (st *site) servePage(w http.ResponseWriter, page RenderResult, urlPath string, prefix string) {
+	err := serveTemplate(w, htmlStruct{
+		Content:        string(page.HTML),
+		Title:          pageTitle(page, urlPath),
+		Description:    page.Description,
+		Layout:         page.Layout,
+		Theme:          st.server.theme,
+		BoundingBox:    st.server.boundingBox,
+		CodeStyleLight: st.server.parser.codeStyleLight,
+		CodeStyleDark:  st.server.parser.codeStyleDark,
+		Prefix:         prefix,
+		Path:           urlPath,
+		Nav:            st.navigation(urlPath, prefix),
+		Headings:       page.Headings,
+		Backlinks:      st.backlinks(urlPath, prefix),
+		LiveReload:     true,
+		Search:         true,
+	})
+	if err != nil {
+		http.Error(w, "Failed to render template", http.StatusInternalServerError)
+	}
+}
+
+// pageTitle returns the title of a rendered page, pages without a title
+// are named after their file
+func pageTitle(page RenderResult, file string) string {
+	if page.Title != "" || !markdownRegex.MatchString(file) {
+		return page.Title
+	}
+	return fileName(file)
+}
+
+// backlinks returns links to the pages linking to a page
+func (st *site) backlinks(urlPath string, prefix string) []navLink {
+	var links []navLink
+	for _, b := range st.graph.backlinks(urlPath) {
+		links = append(links, navLink{Title: b.Title, Href: prefix + b.URL})
+	}
+	return links
+}
+
+// navigation builds the sidebar, breadcrumbs and page links for a page
+func (st *site) navigation(urlPath string, prefix string) *navigation {
+	toc, err := ScanMarkdownFiles(st.directory, st.server.parser.gfm)
+	if err != nil {
+		log.Printf("Error scanning directory: %v", err)
+		return nil
+	}
+
+	// Directory listings are identified by a trailing slash
+	current := urlPath
+	if !markdownRegex.MatchString(current) {
+		current = strings.TrimSuffix(current, "/") + "/"
+	}
+
+	return buildNavigation(toc, current, func(p string) string {
+		return prefix + escapePath(p)
+	})
+}
+
+// parseMarkdownWithLinks processes markdown content and transforms relative links
+func (st *site) parseMarkdownWithLinks(content []byte, currentPath string, prefix string) RenderResult {
+	page, deps := renderPage(st.server.parser, st.directory, st.links, content, currentPath, prefix)
+
+	// Remember the included files for live reload
+	st.mu.Lock()
+	if len(deps) > 0 {
+		st.includes[currentPath] = deps
+	} else {
+		delete(st.includes, currentPath)
+	}
+	st.mu.Unlock()
+	return page
+}
+
+// renderPage renders a markdown file below root the way it is served and
+// returns the URL paths of the files it includes. Links to markdown files
+// become absolute URL paths below prefix.
+func renderPage(parser *Parser, root string, links *wikiIndex, content []byte, currentPath string, prefix string) (RenderResult, []string) {
+	// Expand includes first, included files may contain wiki links
+	content, deps := expandIncludes(root, currentPath, content, links)
+
+	// Then preprocess wiki-style links [[text]] -> [text](text.md)
+	processedContent := preprocessWikiLinks(content, links, currentPath)
+
+	// Then parse the markdown to HTML
+	page := parser.Render(processedContent)
+
+	// The prefix is written into html attributes
+	prefix = template.HTMLEscapeString(prefix)
+	page.HTML = resolveMarkdownLinks(page.HTML, currentPath, prefix)
+
+	// Images, emojis and other absolute references are relative to the mount
+	if prefix != "" {
+		page.HTML = prefixAbsoluteLinks(page.HTML, prefix)
+	}
+	return page, deps
+}
+
+// prefixAbsoluteLinks moves absolute references like src="/pic.png" below
+// prefix. References that already start with prefix are left alone.
+func prefixAbsoluteLinks(htmlContent []byte, prefix string) []byte {
+	return absoluteLinkRegex.ReplaceAllFunc(htmlContent, func(match []byte) []byte {
+		submatch := absoluteLinkRegex.FindSubmatch(match)
+		link := string(submatch[2])
+		if isExternalLink(link) || hasPathPrefix(link, prefix) {
+			return match
+		}
+		return []byte(fmt.Sprintf(`%s="%s%s"`, submatch[1], prefix, link))
+	})
+}
+
+// hasPathPrefix reports whether a URL path is prefix or below it
+func hasPathPrefix(link string, prefix string) bool {
+	rest, ok := strings.CutPrefix(link, prefix)
+	return ok && (rest == "" || strings.ContainsAny(rest[:1], "/#?"))
+}
+
+// Regex for links to markdown files like [text](path.md)
+var markdownLinkRegex = regexp.MustCompile(`href="([^"]+\.md(?:#[^"]*)?)"`)
+
+// resolveMarkdownLinks turns links to markdown files into absolute URL paths
+// below prefix. Relative links are resolved against the current file.
+func resolveMarkdownLinks(htmlContent []byte, currentPath string, prefix string) []byte {
+	currentDir := path.Dir(currentPath)
+
+	return markdownLinkRegex.ReplaceAllFunc(htmlContent, func(match []byte) []byte {
+		// Extract the link
+		submatch := markdownLinkRegex.FindSubmatch(match)
+		if len(submatch) < 2 {
+			return match
+		}
+
+		link := string(submatch[1])
+
+		// Leave links to other sites alone
+		if isExternalLink(link) {
+			return match
+		}
+
+		// Fragments written for GitHub, like #Installing-On-Linux, point to
+		// the heading ids generated by githubSlug
+		link, fragment, hasFragment := strings.Cut(link, "#")
+		if hasFragment {
+			fragment = "#" + normalizeFragment(fragment)
+		}
+
+		// Handle absolute paths (starting with /), they are relative to the
+		// mount unless they already point into it
+		if strings.HasPrefix(link, "/") {
+			if prefix != "" && hasPathPrefix(link, prefix) {
+				return []byte(fmt.Sprintf(`href="%s%s"`, link, fragment))
+			}
+			return []byte(fmt.Sprintf(`href="%s%s%s"`, prefix, link, fragment))
+		}
+
+		// Handle relative paths
+		// Resolve the path relative to the current file's directory.
+		// Joining onto an absolute path never climbs out of the mount.
+		resolvedPath := path.Join(currentDir, link)
+
+		// Make sure the path starts with /
+		if !strings.HasPrefix(resolvedPath, "/") {
+			resolvedPath = "/" + resolvedPath
+		}
+
+		return []byte(fmt.Sprintf(`href="%s%s%s"`, prefix, resolvedPath, fragment))
+	})
+}
+
+// normalizeFragment turns a link fragment into the matching heading slug
+func normalizeFragment(fragment string) string {
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	if slug := githubSlug(fragment); slug != "" {
+		return template.HTMLEscapeString(slug)
+	}
+	return fragment
+}
+
+// isExternalLink reports whether a link points outside of the served tree
+func isExternalLink(link string) bool {
+	return strings.Contains(link, "://") || strings.HasPrefix(link, "//") ||
+		strings.HasPrefix(link, "mailto:") || strings.HasPrefix(link, "data:")
+}
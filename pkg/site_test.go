@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMountLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"image", `<img src="/pic.png">`, `<img src="/api/pic.png">`},
+		{"static file", `<img src="/static/emojis/bowtie.png">`, `<img src="/api/static/emojis/bowtie.png">`},
+		{"directory", `<a href="/sub/">`, `<a href="/api/sub/">`},
+		{"absolute markdown link", `<a href="/guide.md#Intro">`, `<a href="/api/guide.md#intro">`},
+		{"relative markdown link", `<a href="guide.md">`, `<a href="/api/docs/guide.md">`},
+		{"already prefixed image", `<img src="/api/pic.png">`, `<img src="/api/pic.png">`},
+		{"already prefixed markdown link", `<a href="/api/guide.md">`, `<a href="/api/guide.md">`},
+		{"other path starting like the prefix", `<img src="/apis.png">`, `<img src="/api/apis.png">`},
+		{"relative image", `<img src="pic.png">`, `<img src="pic.png">`},
+		{"external link", `<a href="https://example.com/a.md">`, `<a href="https://example.com/a.md">`},
+		{"protocol relative link", `<img src="//example.com/pic.png">`, `<img src="//example.com/pic.png">`},
+		{"anchor", `<a href="#usage">`, `<a href="#usage">`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(prefixAbsoluteLinks(resolveMarkdownLinks([]byte(tt.html), "/docs/README.md", "/api"), "/api"))
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMountPrefixFromName(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "README.md"), []byte("# Home\n\n[Guide](guide.md)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer("localhost", 0, "light", false, false, NewParser("light"))
+	defer s.Shutdown(context.Background())
+	handler, err := s.HandlerAt(root, `/a"b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The prefix comes from the mount, not from the request URI
+	r := httptest.NewRequest(http.MethodGet, "/README.md", nil)
+	r.RequestURI = `/"><script>alert(1)</script>/README.md`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") {
+		t.Error("request URI was written into the page")
+	}
+	for _, want := range []string{`href="/a%22b/static/css/github-print.css"`, `href="/a%22b/guide.md"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+}
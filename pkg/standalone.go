@@ -0,0 +1,166 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/chrishrb/go-grip/defaults"
+)
+
+var (
+	// Regex for stylesheets of the layout, with an optional media query
+	stylesheetRegex = regexp.MustCompile(`<link\s+rel="stylesheet"\s+href="/static/([^"]+)"(?:\s+media="([^"]*)")?\s*/>`)
+	// Regex for scripts loaded from the embedded static files
+	scriptRegex = regexp.MustCompile(`<script src="/static/([^"]+)"></script>`)
+	// Regex for any other reference to the embedded static files
+	staticRefRegex = regexp.MustCompile(`(href|src)="/static/([^"]+)"`)
+)
+
+// Render renders a single markdown file. Without standalone only the html
+// of the document body is written, otherwise a complete html document that
+// embeds all stylesheets, scripts and images and works without a server.
+func (e *Exporter) Render(w io.Writer, file string, standalone bool) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	root, currentPath := includeRoot(file)
+	links := newWikiIndex(root, e.parser.gfm)
+	content, _ = expandIncludes(root, currentPath, content, links)
+	page := e.parser.Render(preprocessWikiLinks(content, links, currentPath))
+	if !standalone {
+		_, err = w.Write(page.HTML)
+		return err
+	}
+
+	htmlContent := inlineLocalImages(page.HTML, root, filepath.Dir(file))
+
+	var buf bytes.Buffer
+	err = renderTemplate(&buf, htmlStruct{
+		Content:        string(htmlContent),
+		Title:          pageTitle(page, file),
+		Description:    page.Description,
+		Layout:         page.Layout,
+		Theme:          e.theme,
+		BoundingBox:    e.boundingBox,
+		CodeStyleLight: e.parser.codeStyleLight,
+		CodeStyleDark:  e.parser.codeStyleDark,
+		Headings:       page.Headings,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	_, err = w.Write(inlineStaticFiles(buf.Bytes()))
+	return err
+}
+
+// includeRoot returns the directory includes of a single file resolve
+// against and the URL path of the file below it. That is the working
+// directory if the file is below it, else the directory of the file.
+func includeRoot(file string) (string, string) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.Dir(file), "/" + filepath.Base(file)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return wd, "/" + filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Dir(abs), "/" + filepath.Base(abs)
+}
+
+// inlineStaticFiles replaces references to the embedded static files with
+// their content. Scripts are only embedded once, so mermaid.js is part of
+// the document only if it has a mermaid diagram.
+func inlineStaticFiles(page []byte) []byte {
+	page = stylesheetRegex.ReplaceAllFunc(page, func(match []byte) []byte {
+		submatch := stylesheetRegex.FindSubmatch(match)
+		css, err := readStaticFile(string(submatch[1]))
+		if err != nil {
+			log.Printf("Failed to inline %s: %v", submatch[1], err)
+			return match
+		}
+		if len(submatch[2]) > 0 {
+			return []byte(fmt.Sprintf("<style media=\"%s\">\n%s</style>", submatch[2], css))
+		}
+		return []byte(fmt.Sprintf("<style>\n%s</style>", css))
+	})
+
+	inlined := map[string]bool{}
+	page = scriptRegex.ReplaceAllFunc(page, func(match []byte) []byte {
+		name := string(scriptRegex.FindSubmatch(match)[1])
+		if inlined[name] {
+			return nil
+		}
+		js, err := defaults.StaticFiles.ReadFile("static/" + name)
+		if err != nil {
+			log.Printf("Failed to inline %s: %v", name, err)
+			return match
+		}
+		inlined[name] = true
+		// A closing tag inside the script would end the script element early
+		js = bytes.ReplaceAll(js, []byte("</script"), []byte(`<\/script`))
+		return []byte(fmt.Sprintf("<script>%s</script>", js))
+	})
+
+	return staticRefRegex.ReplaceAllFunc(page, func(match []byte) []byte {
+		submatch := staticRefRegex.FindSubmatch(match)
+		name := string(submatch[2])
+		data, err := defaults.StaticFiles.ReadFile("static/" + name)
+		if err != nil {
+			log.Printf("Failed to inline %s: %v", name, err)
+			return match
+		}
+		return []byte(fmt.Sprintf(`%s="%s"`, submatch[1], dataURI(name, data)))
+	})
+}
+
+// inlineLocalImages replaces local image sources with data URIs. Relative
+// paths are resolved against the document directory dir, absolute paths
+// against root like they are when served.
+func inlineLocalImages(htmlContent []byte, root string, dir string) []byte {
+	return exportSrcRegex.ReplaceAllFunc(htmlContent, func(match []byte) []byte {
+		src := string(exportSrcRegex.FindSubmatch(match)[1])
+		if isExternalLink(src) || strings.HasPrefix(src, "/static/") {
+			return match
+		}
+
+		name, _, _ := strings.Cut(src, "?")
+		if unescaped, err := url.PathUnescape(name); err == nil {
+			name = unescaped
+		}
+		base := dir
+		if strings.HasPrefix(name, "/") {
+			base = root
+		}
+		data, err := os.ReadFile(filepath.Join(base, filepath.FromSlash(name)))
+		if err != nil {
+			log.Printf("Failed to inline image %s: %v", src, err)
+			return match
+		}
+		return []byte(fmt.Sprintf(`src="%s"`, dataURI(name, data)))
+	})
+}
+
+// dataURI encodes data as a base64 data URI
+func dataURI(name string, data []byte) string {
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+}
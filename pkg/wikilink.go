@@ -0,0 +1,288 @@
+package pkg
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Regex to match [[text]] patterns
+var wikiLinkRegex = regexp.MustCompile(`\[\[([^\]]+)\]\]`)
+
+// wikiIndex resolves wiki links against the markdown files of a directory.
+// It is built on first use and rebuilt after files changed.
+type wikiIndex struct {
+	root string
+	gfm  bool // Read titles with the gfm extensions
+
+	mu    sync.Mutex
+	pages []wikiPage // nil until built
+}
+
+// wikiPage is a markdown file wiki links can point to
+type wikiPage struct {
+	path  string   // URL path of the file
+	names []string // Keys of the file name, the title and the aliases
+}
+
+func newWikiIndex(root string, gfm bool) *wikiIndex {
+	return &wikiIndex{root: root, gfm: gfm}
+}
+
+// invalidate drops the index after a file changed, it is rebuilt on the
+// next lookup
+func (idx *wikiIndex) invalidate(changed string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.pages = nil
+}
+
+// build reads the names of all markdown files, the caller holds the lock
+func (idx *wikiIndex) build() {
+	toc, err := ScanMarkdownFiles(idx.root, idx.gfm)
+	if err != nil {
+		log.Printf("Error scanning directory: %v", err)
+		return
+	}
+
+	idx.pages = []wikiPage{}
+	for _, file := range toc.Files {
+		idx.pages = append(idx.pages, wikiPage{path: "/" + filepath.ToSlash(file.Path), names: wikiPageNames(file)})
+	}
+}
+
+// wikiPageNames returns the keys wiki links match a file by: its name, its
+// title and its aliases
+func wikiPageNames(file MarkdownFile) []string {
+	names := []string{wikiKey(fileName(file.Path)), wikiKey(file.Title)}
+	if content, err := os.ReadFile(file.FullPath); err == nil {
+		_, frontmatter := extractFrontmatter(content)
+		for _, alias := range frontmatterStrings(frontmatter, "aliases", "alias") {
+			names = append(names, wikiKey(alias))
+		}
+	}
+	return names
+}
+
+// wikiTargetKey returns the key of the page a wiki link target names, and
+// the directories it has to be in
+func wikiTargetKey(target string) (string, []string) {
+	segments := strings.Split(strings.Trim(target, "/"), "/")
+	return wikiKey(strings.TrimSuffix(segments[len(segments)-1], ".md")), segments[:len(segments)-1]
+}
+
+// resolve returns the URL path of the page a wiki link target points to.
+// Targets match the file name, title or an alias of a page, a target with
+// directories also has to match the end of the path. Of several matches
+// the one nearest to the current file wins.
+func (idx *wikiIndex) resolve(target string, currentPath string) (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.pages == nil {
+		idx.build()
+	}
+
+	key, dirs := wikiTargetKey(target)
+
+	best, bestDistance := "", 0
+	for _, page := range idx.pages {
+		if !slices.Contains(page.names, key) || !matchesDirs(page.path, dirs) {
+			continue
+		}
+		distance := pathDistance(path.Dir(currentPath), path.Dir(page.path))
+		if best == "" || distance < bestDistance || distance == bestDistance && page.path < best {
+			best, bestDistance = page.path, distance
+		}
+	}
+	return best, best != ""
+}
+
+// matchesDirs reports whether the directories of urlPath end with dirs
+func matchesDirs(urlPath string, dirs []string) bool {
+	pageDirs := dirSegments(path.Dir(urlPath))
+	if len(dirs) > len(pageDirs) {
+		return false
+	}
+	offset := len(pageDirs) - len(dirs)
+	for i, dir := range dirs {
+		if wikiKey(dir) != wikiKey(pageDirs[offset+i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathDistance counts the directories between two directories
+func pathDistance(from string, to string) int {
+	a, b := dirSegments(from), dirSegments(to)
+	common := 0
+	for common < len(a) && common < len(b) && a[common] == b[common] {
+		common++
+	}
+	return len(a) - common + len(b) - common
+}
+
+// dirSegments splits a directory URL path into its names
+func dirSegments(dir string) []string {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return nil
+	}
+	return strings.Split(dir, "/")
+}
+
+// wikiKey normalizes a page name for matching: case, spaces, hyphens and
+// punctuation do not matter
+func wikiKey(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+// frontmatterStrings returns the strings of the given frontmatter keys,
+// each either a single string or a list
+func frontmatterStrings(frontmatter Frontmatter, keys ...string) []string {
+	var values []string
+	for _, key := range keys {
+		switch v := frontmatter[key].(type) {
+		case string:
+			values = append(values, v)
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// wikiLink is a [[wiki link]] in markdown content
+type wikiLink struct {
+	start, end int    // Offsets of the link in the content
+	text       string // Text between the brackets
+}
+
+// findWikiLinks returns the [[wiki links]] of content, except for those in
+// fenced code blocks and code spans
+func findWikiLinks(content []byte) []wikiLink {
+	var found []wikiLink
+	fence := ""
+	offset := 0
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		lineStart := offset
+		offset += len(line)
+		if m := fenceRegex.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if m[1][0] == fence[0] && len(m[1]) >= len(fence) {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+
+		for _, m := range wikiLinkRegex.FindAllStringSubmatchIndex(line, -1) {
+			// Skip wiki links in code spans
+			if strings.Count(line[:m[0]], "`")%2 == 1 {
+				continue
+			}
+			found = append(found, wikiLink{start: lineStart + m[0], end: lineStart + m[1], text: line[m[2]:m[3]]})
+		}
+	}
+	return found
+}
+
+// preprocessWikiLinks converts [[wiki links]] to standard markdown links.
+// [[Page|text]] shows text, [[Page#Heading]] links to a heading. Pages are
+// looked up in links, links to missing pages are marked as such. Code is
+// left as written. Embeds are only expanded on a line of their own, the !
+// of ![[Page]] within text is kept as text.
+func preprocessWikiLinks(content []byte, links *wikiIndex, currentPath string) []byte {
+	found := findWikiLinks(content)
+	if len(found) == 0 {
+		return content
+	}
+
+	var out []byte
+	last := 0
+	for _, link := range found {
+		out = append(out, content[last:link.start]...)
+		// Escape the ! so the link does not become an image
+		if link.start > last && content[link.start-1] == '!' && (link.start < 2 || content[link.start-2] != '\\') {
+			out = append(out[:len(out)-1], '\\', '!')
+		}
+		out = append(out, wikiLinkMarkdown(link.text, links, currentPath)...)
+		last = link.end
+	}
+	return append(out, content[last:]...)
+}
+
+// wikiLinkMarkdown returns the markdown link for the text of a wiki link
+func wikiLinkMarkdown(linkText string, links *wikiIndex, currentPath string) string {
+	// [[_TOC_]] marks the place of the outline
+	if linkText == "_TOC_" {
+		return "[[" + linkText + "]]"
+	}
+
+	target, text, hasText := strings.Cut(linkText, "|")
+	if !hasText {
+		text = target
+	}
+	page, heading, hasHeading := strings.Cut(target, "#")
+	fragment := ""
+	if hasHeading {
+		fragment = "#" + githubSlug(heading)
+	}
+
+	// [[#Heading]] links within the page
+	if page == "" {
+		return fmt.Sprintf("[%s](%s)", text, fragment)
+	}
+
+	urlPath, found := links.resolve(page, currentPath)
+	if !found {
+		return fmt.Sprintf(`<a class="wiki-link-missing" href="%s" title="Page not found">%s</a>`,
+			template.HTMLEscapeString(escapePath(wikiLinkPath(page))), template.HTMLEscapeString(text))
+	}
+	return fmt.Sprintf("[%s](%s%s)", text, escapePath(urlPath), fragment)
+}
+
+// wikiLinkPath returns the file a wiki link points to by convention, e.g.
+// /my-page.md
+func wikiLinkPath(linkText string) string {
+	// Convert to filename: lowercase, spaces to hyphens
+	filename := strings.ToLower(linkText)
+	filename = strings.ReplaceAll(filename, " ", "-")
+	// Handle multiple spaces or special characters
+	filename = regexp.MustCompile(`[^a-z0-9-]+`).ReplaceAllString(filename, "-")
+	// Remove leading/trailing hyphens
+	filename = strings.Trim(filename, "-")
+	// Collapse multiple hyphens
+	filename = regexp.MustCompile(`-+`).ReplaceAllString(filename, "-")
+
+	// Wiki links always resolve from root with leading slash
+	return "/" + filename + ".md"
+}
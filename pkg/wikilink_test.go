@@ -0,0 +1,40 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreprocessWikiLinks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "setup.md"), []byte("# Setup\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	links := newWikiIndex(root, false)
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"link", "See [[Setup]].\n", "See [Setup](/setup.md).\n"},
+		{"text and heading", "[[Setup#Install Steps|install]]\n", "[install](/setup.md#install-steps)\n"},
+		{"same page", "[[#Usage]]\n", "[#Usage](#usage)\n"},
+		{"inline embed", "See ![[Setup]] here\n", "See \\![Setup](/setup.md) here\n"},
+		{"escaped inline embed", "See \\![[Setup]] here\n", "See \\![Setup](/setup.md) here\n"},
+		{"outline marker", "[[_TOC_]]\n", "[[_TOC_]]\n"},
+		{"code span", "Write `[[Setup]]` for [[Setup]]\n", "Write `[[Setup]]` for [Setup](/setup.md)\n"},
+		{"fenced code", "```\n[[Setup]]\n```\n[[Setup]]\n", "```\n[[Setup]]\n```\n[Setup](/setup.md)\n"},
+		{"tilde fence", "~~~~md\n[[Setup]]\n~~~\n[[Setup]]\n~~~~\n", "~~~~md\n[[Setup]]\n~~~\n[[Setup]]\n~~~~\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(preprocessWikiLinks([]byte(tt.markdown), links, "/README.md"))
+			if got != tt.want {
+				t.Errorf("preprocessWikiLinks(%q) = %q, want %q", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}